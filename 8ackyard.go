@@ -5,6 +5,7 @@ import (
 	"path/filepath"
 
 	"github.com/njhsi/8ackyard/internal/commands"
+	"github.com/njhsi/8ackyard/internal/config"
 	"github.com/njhsi/8ackyard/internal/event"
 	"github.com/urfave/cli"
 )
@@ -21,12 +22,26 @@ func main() {
 	app.Version = version
 	app.Copyright = "TODO copyright"
 	app.EnableBashCompletion = true
+	app.Flags = config.GlobalFlags
 
 	app.Commands = []cli.Command{
 		commands.IndexCommand,
+		commands.VerifyCommand,
+		commands.RestoreCommand,
+		commands.RelayoutCommand,
+		commands.ConflictsCommand,
+		commands.QueryCommand,
+		commands.SearchCommand,
+		commands.StatusCommand,
+		commands.DupesCommand,
+		commands.DedupeCommand,
+		commands.WatchCommand,
+		commands.StartCommand,
+		commands.StopCommand,
 	}
 
 	if err := app.Run(os.Args); err != nil {
 		log.Error(err)
+		os.Exit(1)
 	}
 }
@@ -26,9 +26,22 @@ func main() {
 
 	app.Commands = []cli.Command{
 		commands.IndexCommand,
+		commands.VerifyCommand,
+		commands.RestoreCommand,
+		commands.RelayoutCommand,
+		commands.ConflictsCommand,
+		commands.QueryCommand,
+		commands.SearchCommand,
+		commands.StatusCommand,
+		commands.DupesCommand,
+		commands.DedupeCommand,
+		commands.WatchCommand,
+		commands.StartCommand,
+		commands.StopCommand,
 	}
 
 	if err := app.Run(os.Args); err != nil {
 		log.Error(err)
+		os.Exit(1)
 	}
 }
@@ -0,0 +1,235 @@
+package backyard
+
+import (
+	"database/sql"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/njhsi/8ackyard/internal/mutex"
+)
+
+// backfillRow is an indexed or backup file without sha256, indexed before sha256 was.
+type backfillRow struct {
+	Table string // files or filez
+	File8
+	rowid int64
+}
+
+type BackfillJob struct {
+	Row    *backfillRow
+	ChDone chan *backfillRow
+}
+
+func BackfillWorker(jobs <-chan BackfillJob) {
+	for job := range jobs {
+		f := &job.Row.File8
+		f.Sha256 = ""
+		if err, mtime, size := fileStat(f.Name); err != nil || size != f.Size ||
+			(job.Row.Table == "files" && mtime.Unix() != f.TimeModified) {
+			log.Infof("BackfillWorker: %v changed or gone, not backfilling", f.Name)
+		} else if id, sum, err := fileHashes(f.Name); err != nil || id != f.Id {
+			log.Warnf("BackfillWorker: %v does not match id=%v, err=%v", f.Name, Int64ToString(f.Id), err)
+		} else {
+			f.Sha256 = sum
+		}
+		job.ChDone <- job.Row
+	}
+}
+
+// backfillPage is how many rows backfills read from db at once, so that memory stays flat however many there are.
+var backfillPage = 1000
+
+// backfillHashes computes sha256 of files of the host and of backup files, which were indexed without.
+// it takes one run only, as rows indexed since have sha256 already.
+func backfillHashes(opt IndexOptions, db *sql.DB) {
+	var n int
+	if err := db.QueryRow(`select (select count(*) from files where sha256='' and hostname=?)
+                               + (select count(*) from filez where sha256='' and name!='')`, opt.Hostname).Scan(&n); err != nil {
+		log.Errorf("backfill: Query %v", err)
+		return
+	}
+	if n == 0 {
+		return
+	}
+	log.Infof("backfill: %v rows without sha256, hashing", n)
+
+	jobs := make(chan BackfillJob)
+	chDone := make(chan *backfillRow, 50)
+
+	var wg sync.WaitGroup
+	numWorkers := opt.NumWorkers
+	if numWorkers == 0 {
+		numWorkers = 3
+	}
+	wg.Add(numWorkers)
+	for i := 0; i < numWorkers; i++ {
+		go func() {
+			BackfillWorker(jobs)
+			wg.Done()
+		}()
+	}
+
+	chDoneWait := make(chan bool)
+	go func() {
+		var dbtx *sql.Tx
+		var count int
+		for r := range chDone {
+			if r.Sha256 == "" {
+				continue
+			}
+			if dbtx == nil {
+				dbtx, _ = db.Begin()
+			}
+			var err error
+			if r.Table == "files" {
+				_, err = dbtx.Exec("update files set sha256=? where name=? and hostname=? and id=?", r.Sha256, r.Name, opt.Hostname, r.Id)
+			} else {
+				_, err = dbtx.Exec("update filez set sha256=? where id=?", r.Sha256, r.Id)
+			}
+			if err != nil {
+				log.Warnf("backfill db: update %v %v err=%v", r.Table, r.Name, err)
+			}
+			count = count + 1
+			if count%100 == 0 {
+				dbtx.Commit()
+				dbtx = nil
+			}
+		}
+		if dbtx != nil {
+			dbtx.Commit()
+		}
+		log.Infof("backfill: sha256 of %v rows backfilled", count)
+		chDoneWait <- true
+	}()
+
+	queries := []struct {
+		table string
+		query string
+		args  []interface{}
+	}{
+		{"files", "select rowid, name, id, size, timemodified from files where sha256='' and hostname=? and rowid>? order by rowid limit ?",
+			[]interface{}{opt.Hostname}},
+		{"filez", "select rowid, name, id, size, timemodified from filez where sha256='' and name!='' and rowid>? order by rowid limit ?", nil},
+	}
+	for _, q := range queries {
+		var last int64 // rowid, past rows not backfilled too
+		for !mutex.MainWorker.Canceled() {
+			rows := backfillRows(db, q.table, q.query, append(q.args, last, backfillPage)...)
+			for _, r := range rows {
+				if mutex.MainWorker.Canceled() {
+					break
+				}
+				jobs <- BackfillJob{Row: r, ChDone: chDone}
+			}
+			if len(rows) < backfillPage {
+				break
+			}
+			last = rows[len(rows)-1].rowid
+		}
+	}
+	if mutex.MainWorker.Canceled() {
+		log.Warnf("backfill: canceled, the rest is backfilled on next run")
+	}
+
+	close(jobs)
+	wg.Wait()
+	close(chDone)
+	<-chDoneWait
+}
+
+// backfillRows reads a page of rows of table without sha256 by query, closing it before they are hashed and updated.
+func backfillRows(db *sql.DB, table, query string, args ...interface{}) (rows []*backfillRow) {
+	dbrows, err := db.Query(query, args...)
+	if err != nil {
+		log.Errorf("backfill: Query %v", err)
+		return nil
+	}
+	defer dbrows.Close()
+	for dbrows.Next() {
+		r := &backfillRow{Table: table}
+		if err := dbrows.Scan(&r.rowid, &r.Name, &r.Id, &r.Size, &r.TimeModified); err != nil {
+			log.Errorf("backfill: Scan %v", err)
+			continue
+		}
+		rows = append(rows, r)
+	}
+	return rows
+}
+
+// backfillMeta fills media_meta, and media_fts if search, of ids indexed before media_meta was,
+// from their cached exiftool json. ids are queued once by the migration, and dequeued as done, a page at a time.
+func backfillMeta(opt IndexOptions, db *sql.DB, search bool) {
+	var n int
+	if err := db.QueryRow("select count(*) from backfill_meta").Scan(&n); err != nil {
+		log.Errorf("backfill: Query %v", err)
+		return
+	}
+	if n == 0 {
+		return
+	}
+	log.Infof("backfill: %v ids without media_meta, reading cached json", n)
+
+	start := time.Now()
+	var count, filled int
+	last := int64(math.MinInt64)
+	for !mutex.MainWorker.Canceled() {
+		ids := backfillMetaIds(db, last)
+		if len(ids) == 0 {
+			break
+		}
+		last = ids[len(ids)-1]
+
+		dbtx, err := db.Begin()
+		if err != nil {
+			log.Errorf("backfill db: Begin %v", err)
+			return
+		}
+		for _, id := range ids {
+			if mutex.MainWorker.Canceled() {
+				break
+			}
+			if data := cachedMeta(opt.CachePath, id); data != nil {
+				if m := newMediaMeta(id, data); m != nil {
+					if err := saveMediaMeta(dbtx, m); err != nil {
+						log.Warnf("backfill db: media_meta of %v err=%v", Int64ToString(id), err)
+					}
+					filled = filled + 1
+				}
+				if search {
+					if err := saveSearchDoc(dbtx, id, newSearchDoc(id, data)); err != nil {
+						log.Warnf("backfill db: media_fts of %v err=%v", Int64ToString(id), err)
+					}
+				}
+			}
+			if _, err := dbtx.Exec("delete from backfill_meta where id=?", id); err != nil {
+				log.Warnf("backfill db: dequeue %v err=%v", Int64ToString(id), err)
+			}
+			count = count + 1
+		}
+		if err := dbtx.Commit(); err != nil {
+			log.Errorf("backfill db: Commit %v", err)
+		}
+	}
+	if mutex.MainWorker.Canceled() {
+		log.Warnf("backfill: canceled, the rest is backfilled on next run")
+	}
+	log.Infof("backfill: media_meta of %v ids filled, %v done in %v", filled, count, time.Since(start))
+}
+
+// backfillMetaIds reads a page of ids queued in backfill_meta, after id last.
+func backfillMetaIds(db *sql.DB, last int64) (ids []int64) {
+	dbrows, err := db.Query("select id from backfill_meta where id>? order by id limit ?", last, backfillPage)
+	if err != nil {
+		log.Errorf("backfill: Query %v", err)
+		return nil
+	}
+	defer dbrows.Close()
+	for dbrows.Next() {
+		var id int64
+		if err := dbrows.Scan(&id); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
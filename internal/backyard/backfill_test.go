@@ -0,0 +1,84 @@
+package backyard
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackfillHashes(t *testing.T) {
+	defer func(page int) { backfillPage = page }(backfillPage)
+	backfillPage = 1 // a row not backfilled does not stop the next pages
+
+	dir := t.TempDir()
+	name, changed := filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt")
+	for _, n := range []string{name, changed} {
+		if err := os.WriteFile(n, []byte("content of "+n), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	db, err := CreateDb(filepath.Join(dir, "cache"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	id, sum, err := fileHashes(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err, mtime, _ := fileStat(name)
+	assert.NoError(t, err)
+	_, err = db.Exec("insert into files(name, hostname, id, size, timemodified) values(?, 'h', ?, ?, ?)", name, id, len("content of "+name), mtime.Unix())
+	assert.NoError(t, err)
+	_, err = db.Exec("insert into files(name, hostname, id, size, timemodified) values(?, 'h', 1, ?, ?)", changed, len("content of "+changed), mtime.Unix())
+	assert.NoError(t, err)
+	_, err = db.Exec("insert into filez(name, id, size, timemodified) values(?, ?, ?, ?)", name, id, len("content of "+name), mtime.Unix())
+	assert.NoError(t, err)
+
+	backfillHashes(IndexOptions{Hostname: "h"}, db)
+
+	var got string
+	assert.NoError(t, db.QueryRow("select sha256 from files where name=?", name).Scan(&got))
+	assert.Equal(t, sum, got)
+	assert.NoError(t, db.QueryRow("select sha256 from files where name=?", changed).Scan(&got))
+	assert.Equal(t, "", got)
+	assert.NoError(t, db.QueryRow("select sha256 from filez where id=?", id).Scan(&got))
+	assert.Equal(t, sum, got)
+
+	assert.True(t, sameContent(name, id, sum))
+	assert.True(t, sameContent(name, id, ""))
+	assert.False(t, sameContent(name, id, "00"))
+	assert.False(t, sameContent(changed, id, ""))
+}
+
+func TestBackfillMeta(t *testing.T) {
+	defer func(page int) { backfillPage = page }(backfillPage)
+	backfillPage = 1
+
+	cachePath := t.TempDir()
+	db, err := CreateDb(cachePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	exifJson, _ := CacheName(cachePath, Int64ToString(7), "json", "exiftool.json")
+	os.WriteFile(exifJson, []byte(`[{"Make":"FUJIFILM","Model":"X-T3","ImageWidth":6240,"ImageHeight":4160}]`), 0644)
+	db.Exec("insert into backfill_meta(id) values(7), (8), (-9)") // 8 and -9 have no json cached
+
+	backfillMeta(IndexOptions{CachePath: cachePath}, db, false)
+
+	m, err := loadMediaMeta(db, 7)
+	assert.NoError(t, err)
+	if assert.NotNil(t, m) {
+		assert.Equal(t, "X-T3", m.CameraModel)
+		assert.Equal(t, 6240, m.Width)
+	}
+	var n int
+	db.QueryRow("select count(*) from backfill_meta").Scan(&n)
+	assert.Equal(t, 0, n, "once only")
+}
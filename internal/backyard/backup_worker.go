@@ -1,21 +1,27 @@
 package backyard
 
 import (
+	"errors"
 	"os"
-	"path"
 	"path/filepath"
 	"sync"
 	"time"
 
+	"github.com/njhsi/8ackyard/internal/meta"
 	"github.com/photoprism/photoprism/pkg/fs"
 )
 
 type BackupOptions struct {
-	OriginalsPath string
-	BackupPath    string
-	CachePath     string
-	NumWorkers    int
-	Rescan        bool
+	OriginalsPath   string
+	BackupPath      string
+	CachePath       string
+	Layout          *Layout
+	Documents       bool // back up non-media files, by DocumentsLayout
+	DocumentsLayout *Layout
+	NumWorkers      int
+	Rescan          bool
+	AltNames        LinkMode // link alternate names and birth folders of the files to their backup
+	Plan            *Plan    // dry run if not nil, planning copies and renames into it instead
 }
 
 type BackupFsMutex struct {
@@ -27,7 +33,10 @@ type BackupJob struct {
 	Id        int64
 	BackupOpt BackupOptions
 	Files     []*File8
-	BackFile  *File8 //existed in db
+	BackFile  *File8              //existed in db
+	Sidecar   *SidecarOf          //primary media file to follow, if a sidecar
+	Accepted  bool                //conflicts of the id accepted to back up anyway
+	Links     map[string]LinkMode //alternate names linked before, to keep or remove
 	ChDB      chan *File8
 	Bfm       *BackupFsMutex
 }
@@ -42,22 +51,44 @@ func BackupWorker(jobs <-chan *BackupJob) {
 			f0 = job.BackFile
 		}
 
-		if f0.MIMEType != "video" && f0.MIMEType != "audio" && f0.MIMEType != "image" {
-			fb := &File8{Id: f0.Id, Size: 0} //must send back to count on
-			log.Warnf("BackupWorker: ignore this mime[%v]..... %+v", f0.MIMEType, f0)
-			job.ChDB <- fb
-			continue
+		layout := job.BackupOpt.Layout
+		if job.Sidecar == nil && !isMedia(f0.MIMEType) { // documents, and sidecars without a primary back'd up
+			if !job.BackupOpt.Documents {
+				fb := &File8{Id: f0.Id, Size: 0, //must send back to count on
+					plan_: &PlanEntry{Action: PlanSkip, Id: f0.Id, Name: f0.Name, Size: f0.Size, Reason: "not media, see --documents"}}
+				log.Infof("BackupWorker: ignore this mime[%v] of documents..... %+v", f0.MIMEType, f0)
+				job.ChDB <- fb
+				continue
+			}
+			layout = job.BackupOpt.DocumentsLayout
 		}
 
 		fb := *f0 //clone
 		fb.backup_ = job.BackFile
 		fb_basename := filepath.Base(fb.Name)
 
+		var conflicts []*Conflict
+		var fmeta *File8 // first born by metadata, the others by metadata must agree with
+		if f0.TimeBornSrc == TimeBornSrcMeta {
+			fmeta = f0
+		}
+		var fsha *File8 // first with sha256 known, the others must agree with, or collide in xxh3
+		if f0.Sha256 != "" {
+			fsha = f0
+		}
 		for _, f := range job.Files {
 			f_basename := filepath.Base(f.Name)
 
-			if f.Size != fb.Size || (f.TimeBornSrc == TimeBornSrcMeta && f.TimeBorn != fb.TimeBorn) {
-				log.Fatalf("BackupWorker: conflicted files(size, or birth) - %+v, size=%v, born=%v", f, fb.Size, fb.TimeBorn)
+			if f.Size != f0.Size {
+				conflicts = append(conflicts, newConflict(ConflictSize, f, f0))
+			} else if f.Sha256 != "" && fsha != nil && f.Sha256 != fsha.Sha256 {
+				conflicts = append(conflicts, newConflict(ConflictHash, f, fsha))
+			} else if f.TimeBornSrc == TimeBornSrcMeta {
+				if fmeta == nil {
+					fmeta = f
+				} else if f.TimeBorn != fmeta.TimeBorn {
+					conflicts = append(conflicts, newConflict(ConflictBirth, f, fmeta))
+				}
 			}
 			if f.TimeModified < fb.TimeModified {
 				fb.TimeModified = f.TimeModified
@@ -65,30 +96,70 @@ func BackupWorker(jobs <-chan *BackupJob) {
 			if f_basename != fb_basename {
 				log.Warnf("BackupWorker: id=%v with another name %v", f.Id, f_basename)
 			}
-			if len(f_basename) < len(fb_basename) { //TODO: other names could be symlink to the prefered name in backup folder
+			if len(f_basename) < len(fb_basename) { // other names are linked to it by --alt-names
 				fb_basename = f_basename //prefer short name
 			}
 			if f.TimeBorn < fb.TimeBorn {
-				fb.TimeBorn = f.TimeBorn
+				fb.TimeBorn, fb.TimeZone = f.TimeBorn, f.TimeZone
 			}
+			if fsha == nil && f.Sha256 != "" {
+				fsha = f
+			}
+		}
+		if fsha != nil {
+			fb.Sha256 = fsha.Sha256
 		}
+		if len(conflicts) > 0 {
+			if !job.Accepted {
+				log.Errorf("BackupWorker: quarantined id=%v, conflicted files(size, sha256 or birth) - %+v, size=%v, born=%v",
+					Int64ToString(f0.Id), conflicts[0], f0.Size, f0.TimeBorn)
+				job.ChDB <- &File8{Id: f0.Id, Size: 0, conflicts_: conflicts}
+				continue
+			}
+			log.Warnf("BackupWorker: conflicts of id=%v accepted, backing up anyway", Int64ToString(f0.Id))
+		}
+
 		//make the destination to backup
-		birth := time.Unix(fb.TimeBorn, 0).Local()
-		dest := job.BackupOpt.BackupPath + "/" + f0.MIMEType + "/" + birth.Format("2006/01/02") + "/" + fb_basename
-		dest = path.Clean(dest)
+		birth := time.Unix(fb.TimeBorn, 0).In(ZoneLocation(fb.TimeZone))
+		fb.PrimaryId = 0
+		var dest string
+		var data *meta.Data
+		var err error
+		if job.Sidecar != nil { // next to the primary, named after it
+			dest = sidecarName(job.Sidecar.File.Name, job.Sidecar.Primary, job.Sidecar.Backup.Name)
+			fb.PrimaryId = job.Sidecar.Backup.Id
+		} else {
+			data = cachedMeta(job.BackupOpt.CachePath, fb.Id)
+			if data == nil && job.BackupOpt.Plan != nil { // extracted by the dry run
+				data = cachedMeta(job.BackupOpt.Plan.cachePath, fb.Id)
+			}
+			dest, err = layout.Dest(job.BackupOpt.BackupPath, NewLayoutData(&fb, fb_basename, data))
+		}
+		if err != nil {
+			log.Errorf("BackupWorker: no dest for %+v - %v", fb, err)
+			job.ChDB <- &File8{Id: f0.Id, Size: 0,
+				plan_: &PlanEntry{Action: PlanSkip, Id: f0.Id, Name: f0.Name, Size: f0.Size, Reason: err.Error()}}
+			continue
+		}
+
+		layoutDest := dest
 
 		//do backup on disk: 1)check if existed on disk
 		path_final := "" // if backup confirmed finished on disk
 
 		if job.BackFile != nil && fs.FileExists(job.BackFile.Name) { //TODO: hostname check
 			job.Bfm.Lock(job.BackFile.Name)
-			id_fb_ondisk := int64(fileXXH3(job.BackFile.Name))
-			if id_fb_ondisk == job.BackFile.Id {
+			id_fb_ondisk, same := job.onDisk(job.BackFile.Name, &fb)
+			if same && id_fb_ondisk == job.BackFile.Id {
 				//return after confirm naming
 				log.Infof("BackupWorker: job.BackFile(%v) existed on disk with same id(%v), do rename/%v to dest=%v ",
 					job.BackFile.Name, id_fb_ondisk, dest != job.BackFile.Name, dest)
 				path_final = dest
-				if dest != job.BackFile.Name {
+				if dest != job.BackFile.Name && job.BackupOpt.Plan != nil {
+					job.BackupOpt.Plan.taken(dest, fb.Id) // as if renamed already
+					fb.plan_ = &PlanEntry{Action: PlanRename, Id: fb.Id, Name: job.BackFile.Name, Dest: dest, Size: fb.Size}
+				} else if dest != job.BackFile.Name {
+					os.MkdirAll(filepath.Dir(dest), 0755)
 					if err := os.Rename(job.BackFile.Name, dest); err != nil {
 						log.Warnf("BackupWorker: existed on disk with same id, but os.Rename failed %v -> %v", job.BackFile.Name, dest)
 						path_final = "" //reset
@@ -100,12 +171,16 @@ func BackupWorker(jobs <-chan *BackupJob) {
 			job.Bfm.UnLock(job.BackFile.Name)
 		}
 
-		for len(path_final) == 0 && fs.FileExists(dest) {
-			job.Bfm.Lock(dest)
-			id_f_ondisk := int64(fileXXH3(dest)) //TODO: stat check to speed up..
-			job.Bfm.UnLock(dest)
+		for len(path_final) == 0 && (job.BackupOpt.Plan.taken(dest, fb.Id) || fs.FileExists(dest)) {
+			var id_f_ondisk int64 // 0 if planned for another, not on disk yet
+			same := false
+			if fs.FileExists(dest) {
+				job.Bfm.Lock(dest)
+				id_f_ondisk, same = job.onDisk(dest, &fb) //TODO: stat check to speed up..
+				job.Bfm.UnLock(dest)
+			}
 
-			if fb.Id == id_f_ondisk {
+			if same {
 				path_final = dest
 				log.Infof("BackupWorker: dest=%v existed on disk with same id of fb=%+v", dest, fb)
 				//TODO: confirm stats
@@ -113,27 +188,51 @@ func BackupWorker(jobs <-chan *BackupJob) {
 				log.Warnf("BackupWorker: dest=%v existed on disk with different id[%v], fb=%+v", dest, id_f_ondisk, fb)
 				dest = dest + "-" + Int64ToString(fb.Id) + "_XXH3"
 				if len(dest) > 256 {
-					log.Fatalf("BackupWorker: can not choose dest(%v) at all, fb=%+v", dest, fb)
+					log.Errorf("BackupWorker: quarantined, can not choose dest(%v) at all, fb=%+v", dest, fb)
+					conflicts = append(conflicts, newConflict(ConflictDest, &File8{Id: fb.Id, Name: dest, Hostname: fb.Hostname}, &fb))
+					dest = ""
+					break
 				}
 			}
 		}
+		if len(dest) == 0 {
+			job.ChDB <- &File8{Id: fb.Id, Size: 0, conflicts_: conflicts}
+			continue
+		}
 		if len(path_final) == 0 && len(dest) > 0 {
 			for _, f := range job.Files {
 				if err, mtime, size := fileStat(f.Name); err == nil &&
 					size == f.Size && mtime.Unix() == f.TimeModified {
+					if job.BackupOpt.Plan != nil {
+						fb.plan_ = &PlanEntry{Action: PlanCopy, Id: fb.Id, Name: f.Name, Dest: dest, Size: fb.Size}
+						path_final = dest
+						break
+					}
 					log.Infof("BackupWorker: going to do copy on disk %v->%v, id=%v ", f.Name, dest, f.Id)
 					dest_tmp := dest + "-" + Int64ToString(f.Id) + ".tmp"
 					job.Bfm.Lock(dest_tmp)
 					err := CopyWithStat(f.Name, dest_tmp) //!!TODO: stat
-					if err == nil && f.Id == int64(fileXXH3(dest_tmp)) {
+					if err == nil {
+						err = syncFile(dest_tmp) // on disk before renamed, and recorded in filez
+					}
+					if err == nil && !sameContent(dest_tmp, f.Id, fb.Sha256) {
+						err = errors.New("not identically copied")
+					}
+					if err == nil {
 						job.Bfm.Lock(dest)
-						os.Rename(dest_tmp, dest)
+						err = os.Rename(dest_tmp, dest)
+						if err == nil {
+							err = syncDir(filepath.Dir(dest)) // the rename on disk too, before recorded in filez
+						}
 						job.Bfm.UnLock(dest)
+					}
+					if err == nil {
+						job.Bfm.UnLock(dest_tmp)
 						path_final = dest
 						break
-					} else {
-						log.Warnf("BackupWorker: failed to copy on disk or not identically copied. %v(%v)->%v, err=%v ", f.Name, f.Id, dest_tmp, err)
 					}
+					log.Warnf("BackupWorker: failed to copy on disk or not identically copied. %v(%v)->%v, err=%v ", f.Name, f.Id, dest_tmp, err)
+					os.Remove(dest_tmp)
 					job.Bfm.UnLock(dest_tmp)
 				}
 			}
@@ -141,6 +240,9 @@ func BackupWorker(jobs <-chan *BackupJob) {
 
 		//update fb
 		fb.Name = path_final
+		if len(path_final) > 0 && job.Sidecar == nil && job.BackupOpt.Plan == nil {
+			fb.links_ = linkAltNames(job, layout, &fb, data, path_final, layoutDest)
+		}
 
 		job.ChDB <- &fb
 
@@ -148,6 +250,42 @@ func BackupWorker(jobs <-chan *BackupJob) {
 	}
 }
 
+// onDisk returns the id of the content of file name, and if it is of fb.
+// by size only in a dry run without hashing, as if of fb then.
+func (job *BackupJob) onDisk(name string, fb *File8) (int64, bool) {
+	if job.BackupOpt.Plan != nil && job.BackupOpt.Plan.NoHash {
+		err, _, size := fileStat(name)
+		return fb.Id, err == nil && size == fb.Size
+	}
+	return contentOf(name, fb.Id, fb.Sha256)
+}
+
+// cachedMeta returns metadata of id cached by indexing, or nil if not cached.
+func cachedMeta(cachePath string, id int64) *meta.Data {
+	hash := Int64ToString(id)
+	dir, err := fs.CachePath(cachePath, hash, "json", false) // not created, only read
+	if err != nil {
+		return nil
+	}
+	exifJson := filepath.Join(dir, hash+"_exiftool.json")
+	if !fs.FileExists(exifJson) {
+		return nil
+	}
+
+	jbuf, err := os.ReadFile(exifJson)
+	if err != nil {
+		return nil
+	}
+
+	data := &meta.Data{}
+	if err := data.Exiftool(jbuf, ""); err != nil {
+		log.Warnf("cachedMeta: %v - %v", exifJson, err)
+		return nil
+	}
+
+	return data
+}
+
 func NewBackupFsMutex() *BackupFsMutex {
 	bfm := &BackupFsMutex{}
 	bfm.files = make(map[string]*sync.RWMutex)
@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"path/filepath"
 
-	"github.com/njhsi/8ackyard/internal/config"
 	"github.com/njhsi/8ackyard/internal/event"
 	"github.com/photoprism/photoprism/pkg/fs"
 )
@@ -20,17 +19,17 @@ func logWarn(prefix string, err error) {
 }
 
 // CachePath returns a cache directory name based on the base path, file hash and cache namespace.
-func CachePath(fileHash, namespace string) (cachePath string, err error) {
-	return fs.CachePath(config.CachePath(), fileHash, namespace, true)
+func CachePath(cacheDir, fileHash, namespace string) (cachePath string, err error) {
+	return fs.CachePath(cacheDir, fileHash, namespace, true)
 }
 
 // CacheName returns an absolute cache file name based on the base path, file hash and cache namespace.
-func CacheName(fileHash, namespace, cacheKey string) (cacheName string, err error) {
+func CacheName(cacheDir, fileHash, namespace, cacheKey string) (cacheName string, err error) {
 	if cacheKey == "" {
 		return "", fmt.Errorf("cache: key for hash '%s' is empty", fileHash)
 	}
 
-	cachePath, err := CachePath(fileHash, namespace)
+	cachePath, err := CachePath(cacheDir, fileHash, namespace)
 
 	if err != nil {
 		return "", err
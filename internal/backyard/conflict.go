@@ -0,0 +1,145 @@
+package backyard
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+type ConflictReason string
+
+const (
+	ConflictSize  ConflictReason = "size"   // same id, different sizes
+	ConflictHash  ConflictReason = "sha256" // same id, different sha256, a collision of xxh3
+	ConflictBirth ConflictReason = "birth"  // same id, different birth times in metadata
+	ConflictDest  ConflictReason = "dest"   // no free destination name in the backup path
+)
+
+// ConflictAccepted is the resolution to back up a quarantined id anyway, by its earliest born file.
+const ConflictAccepted = "accepted"
+
+// Conflict records a backup job quarantined for manual resolution, with both candidates and the reason.
+type Conflict struct {
+	Id            int64          `json:"id"`
+	Reason        ConflictReason `json:"reason"`
+	Hostname      string         `json:"hostname"`
+	Name          string         `json:"name"`
+	Size          int64          `json:"size"`
+	TimeBorn      int64          `json:"timeborn"`
+	OtherName     string         `json:"other_name"`
+	OtherSize     int64          `json:"other_size"`
+	OtherTimeBorn int64          `json:"other_timeborn"`
+	Sha256        string         `json:"sha256,omitempty"`
+	OtherSha256   string         `json:"other_sha256,omitempty"`
+	TimeFound     int64          `json:"timefound"`
+	Resolution    string         `json:"resolution,omitempty"`
+}
+
+// newConflict returns the conflict of f against other, the file chosen to back up.
+func newConflict(reason ConflictReason, f, other *File8) *Conflict {
+	return &Conflict{
+		Id:            other.Id,
+		Reason:        reason,
+		Hostname:      f.Hostname,
+		Name:          f.Name,
+		Size:          f.Size,
+		TimeBorn:      f.TimeBorn,
+		OtherName:     other.Name,
+		OtherSize:     other.Size,
+		OtherTimeBorn: other.TimeBorn,
+		Sha256:        f.Sha256,
+		OtherSha256:   other.Sha256,
+		TimeFound:     time.Now().Unix(),
+	}
+}
+
+// recordConflict adds or refreshes the conflict in db, keeping its resolution.
+func recordConflict(dbtx *sql.Tx, c *Conflict) error {
+	_, err := dbtx.Exec(`insert into conflicts(id, reason, hostname, name, size, timeborn, othername, othersize, othertimeborn, timefound,
+                             sha256, othersha256)
+                             values(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+                             on conflict(id, reason, name, othername) do update set
+                             hostname=excluded.hostname, size=excluded.size, timeborn=excluded.timeborn,
+                             othersize=excluded.othersize, othertimeborn=excluded.othertimeborn, timefound=excluded.timefound,
+                             sha256=excluded.sha256, othersha256=excluded.othersha256`,
+		c.Id, c.Reason, c.Hostname, c.Name, c.Size, c.TimeBorn, c.OtherName, c.OtherSize, c.OtherTimeBorn, c.TimeFound,
+		c.Sha256, c.OtherSha256)
+	return err
+}
+
+// conflictAccepted tells if id has conflicts, all accepted to back up anyway.
+// sha256 conflicts never are, as if accepted by a version before they were refused.
+func conflictAccepted(dbtx *sql.Tx, id int64) bool {
+	var total, accepted int
+	row := dbtx.QueryRow("select count(*), count(case when resolution=? and reason!=? then 1 end) from conflicts where id=?",
+		ConflictAccepted, ConflictHash, id)
+	if err := row.Scan(&total, &accepted); err != nil {
+		log.Warnf("conflictAccepted: id=%v - %v", id, err)
+		return false
+	}
+	return total > 0 && total == accepted
+}
+
+// Conflicts lists the conflicts in the cache, only unresolved unless all.
+func Conflicts(cachePath string, all bool) ([]Conflict, error) {
+	db, err := OpenDb(cachePath)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`select id, reason, hostname, name, size, timeborn, othername, othersize, othertimeborn, timefound, resolution,
+                               sha256, othersha256
+                               from conflicts where resolution='' or ? order by timefound, id`, all)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var conflicts []Conflict
+	for rows.Next() {
+		var c Conflict
+		if err := rows.Scan(&c.Id, &c.Reason, &c.Hostname, &c.Name, &c.Size, &c.TimeBorn,
+			&c.OtherName, &c.OtherSize, &c.OtherTimeBorn, &c.TimeFound, &c.Resolution, &c.Sha256, &c.OtherSha256); err != nil {
+			return nil, err
+		}
+		conflicts = append(conflicts, c)
+	}
+
+	return conflicts, rows.Err()
+}
+
+// ResolveConflicts sets the resolution of the conflicts of id, or removes them if resolution is empty,
+// so that the next backup checks the id again. it returns the number of conflicts resolved.
+// sha256 conflicts are refused to accept: their files are different contents under one id, of which filez keeps one.
+func ResolveConflicts(cachePath string, id int64, resolution string) (int64, error) {
+	db, err := OpenDb(cachePath)
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	if resolution == ConflictAccepted {
+		var n int
+		if err := db.QueryRow("select count(*) from conflicts where id=? and reason=?", id, ConflictHash).Scan(&n); err != nil {
+			return 0, err
+		}
+		if n > 0 {
+			return 0, fmt.Errorf("conflicts: id %v is not accepted, its files are different contents colliding in xxh3, "+
+				"and only one of them would be backed up; copy the others aside by hand and move them out of the originals, then --clear it",
+				Int64ToString(id))
+		}
+	}
+
+	var result sql.Result
+	if resolution == "" {
+		result, err = db.Exec("delete from conflicts where id=?", id)
+	} else {
+		result, err = db.Exec("update conflicts set resolution=? where id=?", resolution, id)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
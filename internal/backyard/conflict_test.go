@@ -0,0 +1,106 @@
+package backyard
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackupWorkerQuarantine(t *testing.T) {
+	layout, _ := NewLayout(DefaultLayout)
+	files := []*File8{
+		{Id: 1, Name: "/mnt/media/a.jpg", Size: 10, MIMEType: "image", TimeBorn: 100, TimeBornSrc: TimeBornSrcMeta},
+		{Id: 1, Name: "/mnt/media/b.jpg", Size: 11, MIMEType: "image", TimeBorn: 100, TimeBornSrc: TimeBornSrcMeta},
+		{Id: 1, Name: "/mnt/media/c.jpg", Size: 10, MIMEType: "image", TimeBorn: 200, TimeBornSrc: TimeBornSrcMeta},
+		{Id: 1, Name: "/mnt/media/d.jpg", Size: 10, MIMEType: "image", TimeBorn: 300, TimeBornSrc: TimeBornSrcName, Sha256: "aa"},
+		{Id: 1, Name: "/mnt/media/e.jpg", Size: 10, MIMEType: "image", TimeBorn: 400, TimeBornSrc: TimeBornSrcName, Sha256: "bb"},
+	}
+
+	jobs := make(chan *BackupJob, 1)
+	chDb := make(chan *File8, 1)
+	jobs <- &BackupJob{Id: 1, BackupOpt: BackupOptions{BackupPath: t.TempDir(), Layout: layout}, Files: files, ChDB: chDb, Bfm: NewBackupFsMutex()}
+	close(jobs)
+	BackupWorker(jobs)
+
+	fb := <-chDb
+	assert.Equal(t, int64(0), fb.Size)
+	if assert.Len(t, fb.conflicts_, 3) {
+		assert.Equal(t, ConflictSize, fb.conflicts_[0].Reason)
+		assert.Equal(t, "/mnt/media/b.jpg", fb.conflicts_[0].Name)
+		assert.Equal(t, "/mnt/media/a.jpg", fb.conflicts_[0].OtherName)
+		assert.Equal(t, ConflictBirth, fb.conflicts_[1].Reason)
+		assert.Equal(t, "/mnt/media/c.jpg", fb.conflicts_[1].Name)
+		assert.Equal(t, ConflictHash, fb.conflicts_[2].Reason)
+		assert.Equal(t, "/mnt/media/e.jpg", fb.conflicts_[2].Name)
+		assert.Equal(t, "/mnt/media/d.jpg", fb.conflicts_[2].OtherName)
+	}
+}
+
+func TestConflicts(t *testing.T) {
+	cachePath := t.TempDir()
+	db, err := CreateDb(cachePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := &File8{Id: 1, Name: "/mnt/media/a.jpg", Hostname: "h", Size: 10}
+	b := &File8{Id: 1, Name: "/mnt/media/b.jpg", Hostname: "h", Size: 11}
+	dbtx, _ := db.Begin()
+	assert.NoError(t, recordConflict(dbtx, newConflict(ConflictSize, b, a)))
+	assert.NoError(t, recordConflict(dbtx, newConflict(ConflictSize, b, a))) // found again
+	assert.False(t, conflictAccepted(dbtx, 1))
+	assert.NoError(t, dbtx.Commit())
+	db.Close()
+
+	conflicts, err := Conflicts(cachePath, false)
+	assert.NoError(t, err)
+	if assert.Len(t, conflicts, 1) {
+		assert.Equal(t, "/mnt/media/b.jpg", conflicts[0].Name)
+		assert.Equal(t, int64(10), conflicts[0].OtherSize)
+	}
+
+	n, err := ResolveConflicts(cachePath, 1, ConflictAccepted)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	conflicts, _ = Conflicts(cachePath, false)
+	assert.Len(t, conflicts, 0)
+	conflicts, _ = Conflicts(cachePath, true)
+	assert.Len(t, conflicts, 1)
+
+	db, _ = OpenDb(cachePath)
+	dbtx, _ = db.Begin()
+	assert.True(t, conflictAccepted(dbtx, 1))
+	assert.NoError(t, recordConflict(dbtx, newConflict(ConflictSize, b, a))) // keeps resolution
+	assert.True(t, conflictAccepted(dbtx, 1))
+	dbtx.Commit()
+	db.Close()
+
+	n, err = ResolveConflicts(cachePath, 1, "")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	conflicts, _ = Conflicts(cachePath, true)
+	assert.Len(t, conflicts, 0)
+
+	t.Run("sha256", func(t *testing.T) { // different contents colliding in xxh3
+		d := &File8{Id: 2, Name: "/mnt/media/d.jpg", Hostname: "h", Size: 10, Sha256: "aa"}
+		e := &File8{Id: 2, Name: "/mnt/media/e.jpg", Hostname: "h", Size: 10, Sha256: "bb"}
+		db, _ := OpenDb(cachePath)
+		defer db.Close()
+		dbtx, _ := db.Begin()
+		assert.NoError(t, recordConflict(dbtx, newConflict(ConflictHash, e, d)))
+		assert.NoError(t, dbtx.Commit())
+
+		n, err := ResolveConflicts(cachePath, 2, ConflictAccepted)
+		assert.Error(t, err)
+		assert.Equal(t, int64(0), n)
+
+		db.Exec("update conflicts set resolution=? where id=2", ConflictAccepted) // by a version before
+		dbtx, _ = db.Begin()
+		assert.False(t, conflictAccepted(dbtx, 2))
+		dbtx.Rollback()
+
+		n, err = ResolveConflicts(cachePath, 2, "")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), n)
+	})
+}
@@ -0,0 +1,47 @@
+package backyard
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+
+	"github.com/photoprism/photoprism/pkg/fs"
+)
+
+// DbName returns the file name of the index db in the cache path.
+func DbName(cachePath string) string {
+	return cachePath + "/indexed.db"
+}
+
+// CreateDb opens the index db in the cache path, creating it if not existed, and migrates its schema.
+func CreateDb(cachePath string) (*sql.DB, error) {
+	if err := os.MkdirAll(cachePath, 0755); err != nil {
+		return nil, err
+	}
+
+	return openDb(DbName(cachePath))
+}
+
+// OpenDb opens an existing index db in the cache path, and migrates its schema.
+func OpenDb(cachePath string) (*sql.DB, error) {
+	dbName := DbName(cachePath)
+	if !fs.FileExists(dbName) {
+		return nil, fmt.Errorf("db: %s does not exist, run index first", dbName)
+	}
+
+	return openDb(dbName)
+}
+
+func openDb(dbName string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite3", dbName)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := migrateDb(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("db: %s - %v", dbName, err)
+	}
+
+	return db, nil
+}
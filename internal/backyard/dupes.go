@@ -0,0 +1,307 @@
+package backyard
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// DupeGroup is indexed files of a host with the same content, Keep the one to keep by the simplest name.
+type DupeGroup struct {
+	Id          int64    `json:"id"`
+	Size        int64    `json:"size"`
+	Sha256      string   `json:"sha256,omitempty"`
+	Keep        string   `json:"keep"`
+	Extra       []string `json:"extra"`
+	Reclaimable int64    `json:"reclaimable"` // bytes freed if the extra copies go, not counting hardlinks
+	Backup      string   `json:"backup,omitempty"`
+
+	backupSha256 string // of the backup in filez, to confirm it before a copy goes
+}
+
+// dupeCopyRegexp matches stems marking a copy: IMG_0001(1), IMG_0001 (1), IMG_0001 copy 2, IMG_0001_3f2a9c
+var dupeCopyRegexp = regexp.MustCompile(`(?i)( ?\(\d+\)| copy( \d+)?|_[0-9a-f]{5,})$`)
+
+// dupeCopies returns how many copy marks the stem of base has, like IMG_0001(1)_3f2a9c has 2.
+func dupeCopies(base string) (n int) {
+	stem := sidecarStem(base)
+	for {
+		loc := dupeCopyRegexp.FindStringIndex(stem)
+		if loc == nil {
+			return n
+		}
+		mark := stem[loc[0]:]
+		if strings.HasPrefix(mark, "_") && strings.IndexAny(strings.ToLower(mark), "abcdef") < 0 {
+			return n // _20190612 is a date, not a hash
+		}
+		n, stem = n+1, stem[:loc[0]]
+	}
+}
+
+// simplestName returns the name to keep of duplicates: fewest copy marks, then shortest base name,
+// then shortest path, then first by order.
+func simplestName(names []string) string {
+	sorted := append([]string{}, names...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		ba, bb := filepath.Base(a), filepath.Base(b)
+		if ca, cb := dupeCopies(ba), dupeCopies(bb); ca != cb {
+			return ca < cb
+		}
+		if len(ba) != len(bb) {
+			return len(ba) < len(bb)
+		}
+		if len(a) != len(b) {
+			return len(a) < len(b)
+		}
+		return a < b
+	})
+	return sorted[0]
+}
+
+// reclaimable returns bytes freed by removing all but one of names, counting files hardlinked to each other once,
+// and files not found locally as separate.
+func reclaimable(names []string, size int64) int64 {
+	var seen []os.FileInfo
+	distinct := 0
+	for _, name := range names {
+		fi, err := os.Stat(name)
+		if err != nil {
+			distinct++
+			continue
+		}
+		linked := false
+		for _, s := range seen {
+			if os.SameFile(s, fi) {
+				linked = true
+				break
+			}
+		}
+		if !linked {
+			seen, distinct = append(seen, fi), distinct+1
+		}
+	}
+	if distinct == 0 {
+		return 0
+	}
+	return size * int64(distinct-1)
+}
+
+// Dupes lists groups of indexed files of hostname, this host if empty, with the same content, largest reclaimable first.
+// files only under the dir prefix if not empty.
+func Dupes(cachePath, hostname, prefix string) ([]DupeGroup, error) {
+	if hostname == "" {
+		hostname, _ = os.Hostname()
+	}
+	if prefix != "" { // not /photos/abc by /photos/a
+		prefix = strings.TrimSuffix(prefix, "/") + "/"
+	}
+	db, err := OpenDb(cachePath)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`select f.id, f.name, f.size, f.sha256, coalesce(z.name, ''), coalesce(z.sha256, '') from files f
+                               left join filez z on z.id=f.id
+                               where f.hostname=? and substr(f.name, 1, length(?))=? and f.id in
+                               (select id from files where hostname=? and substr(name, 1, length(?))=? group by id having count(*) > 1)
+                               order by f.id, f.name`, hostname, prefix, prefix, hostname, prefix, prefix)
+	if err != nil {
+		return nil, fmt.Errorf("dupes: %v", err)
+	}
+	defer rows.Close()
+
+	var groups []DupeGroup
+	var names []string
+	var g *DupeGroup
+	done := func() {
+		if g == nil {
+			return
+		}
+		g.Keep = simplestName(names)
+		for _, name := range names {
+			if name != g.Keep {
+				g.Extra = append(g.Extra, name)
+			}
+		}
+		g.Reclaimable = reclaimable(names, g.Size)
+		groups = append(groups, *g)
+	}
+	for rows.Next() {
+		var id, size int64
+		var name, sum, backup, backupSum string
+		if err := rows.Scan(&id, &name, &size, &sum, &backup, &backupSum); err != nil {
+			return nil, fmt.Errorf("dupes: %v", err)
+		}
+		if g == nil || g.Id != id {
+			done()
+			g, names = &DupeGroup{Id: id, Size: size, Backup: backup, backupSha256: backupSum}, nil
+		}
+		if g.Sha256 == "" {
+			g.Sha256 = sum
+		}
+		names = append(names, name)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("dupes: %v", err)
+	}
+	done()
+
+	sort.SliceStable(groups, func(i, j int) bool { return groups[i].Reclaimable > groups[j].Reclaimable })
+	return groups, nil
+}
+
+type DedupeMode string
+
+const (
+	DedupeHardlink DedupeMode = "hardlink" // extra copies become hardlinks of the kept one
+	DedupeTrash    DedupeMode = "trash"    // extra copies move into the trash dir, under their full path
+)
+
+type DedupeOptions struct {
+	CachePath string
+	Hostname  string
+	Prefix    string // only files under it, if not empty
+	Mode      DedupeMode
+	TrashPath string
+	DryRun    bool // only report what would be done
+}
+
+// DedupeResult is what was done, or would be done, to an extra copy.
+type DedupeResult struct {
+	Id     int64  `json:"id"`
+	Name   string `json:"name"`
+	Keep   string `json:"keep"`
+	Action string `json:"action"` // hardlink, trash, or skip
+	Dest   string `json:"dest,omitempty"`
+	Reason string `json:"reason,omitempty"` // why skipped, or failed
+}
+
+// Dedupe replaces extra copies of dupes in the originals by hardlinks of the kept one, or moves them to a trash dir.
+// a group is only touched if its backup is in filez and found on disk with its content, and every file still has the indexed content.
+func Dedupe(opt DedupeOptions) ([]DedupeResult, error) {
+	if opt.Mode != DedupeHardlink && opt.Mode != DedupeTrash {
+		return nil, fmt.Errorf("dedupe: unknown mode %q", opt.Mode)
+	}
+	if opt.Mode == DedupeTrash && opt.TrashPath == "" {
+		return nil, fmt.Errorf("dedupe: trash path is a must")
+	}
+	if opt.Hostname == "" {
+		opt.Hostname, _ = os.Hostname()
+	}
+
+	groups, err := Dupes(opt.CachePath, opt.Hostname, opt.Prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []DedupeResult
+	var trashed []string
+	for _, g := range groups {
+		skip := ""
+		if g.Backup == "" {
+			skip = "not backed up"
+		} else if err, _, size := fileStat(g.Backup); err != nil || size != g.Size || !sameContent(g.Backup, g.Id, g.backupSha256) {
+			skip = fmt.Sprintf("backup %v not found as indexed", g.Backup)
+		} else if !sameContent(g.Keep, g.Id, g.Sha256) {
+			skip = fmt.Sprintf("%v changed since indexed", g.Keep)
+		}
+
+		for _, name := range g.Extra {
+			r := DedupeResult{Id: g.Id, Name: name, Keep: g.Keep, Action: "skip", Reason: skip}
+			if skip == "" {
+				dedupeFile(opt, g, &r)
+				if r.Action == string(DedupeTrash) && r.Reason == "" && !opt.DryRun {
+					trashed = append(trashed, name)
+				}
+			}
+			results = append(results, r)
+		}
+	}
+
+	if len(trashed) > 0 { // gone from the originals, so from the index too
+		db, err := OpenDb(opt.CachePath)
+		if err != nil {
+			return results, err
+		}
+		defer db.Close()
+		dbtx, err := db.Begin()
+		if err != nil {
+			return results, err
+		}
+		for _, name := range trashed {
+			if _, err := dbtx.Exec("delete from files where name=? and hostname=?", name, opt.Hostname); err != nil {
+				log.Warnf("dedupe: delete %v err=%v", name, err)
+			}
+		}
+		if err := dbtx.Commit(); err != nil {
+			return results, err
+		}
+	}
+
+	return results, nil
+}
+
+// dedupeFile hardlinks or trashes the extra copy r.Name of group g, setting r.Reason if it failed.
+func dedupeFile(opt DedupeOptions, g DupeGroup, r *DedupeResult) {
+	keepInfo, err := os.Stat(g.Keep)
+	if err != nil {
+		r.Action, r.Reason = "skip", err.Error()
+		return
+	}
+	info, err := os.Stat(r.Name)
+	if err != nil {
+		r.Action, r.Reason = "skip", err.Error()
+		return
+	}
+
+	switch opt.Mode {
+	case DedupeHardlink:
+		if os.SameFile(keepInfo, info) {
+			r.Reason = "hardlinked already"
+			return
+		}
+	case DedupeTrash:
+		r.Dest = filepath.Join(opt.TrashPath, r.Name)
+		if _, err := os.Lstat(r.Dest); err == nil {
+			r.Action, r.Reason = "skip", "exists in trash already"
+			return
+		}
+	}
+	if !sameContent(r.Name, g.Id, g.Sha256) {
+		r.Action, r.Reason = "skip", "changed since indexed"
+		return
+	}
+	r.Action = string(opt.Mode)
+	if opt.DryRun {
+		return
+	}
+
+	switch opt.Mode {
+	case DedupeHardlink:
+		tmp := r.Name + ".8ackyard-link"
+		if err := os.Link(g.Keep, tmp); err != nil {
+			r.Reason = err.Error()
+			return
+		}
+		if err := os.Rename(tmp, r.Name); err != nil {
+			os.Remove(tmp)
+			r.Reason = err.Error()
+			return
+		}
+	case DedupeTrash:
+		if err := os.MkdirAll(filepath.Dir(r.Dest), 0755); err != nil {
+			r.Reason = err.Error()
+			return
+		}
+		if err := os.Rename(r.Name, r.Dest); err != nil {
+			r.Reason = err.Error()
+			return
+		}
+	}
+	log.Infof("dedupe: %v %v of %v", r.Action, r.Name, r.Keep)
+}
@@ -0,0 +1,147 @@
+package backyard
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSimplestName(t *testing.T) {
+	assert.Equal(t, 0, dupeCopies("IMG_20190612_101010.jpg"))
+	assert.Equal(t, 1, dupeCopies("IMG_0001(1).jpg"))
+	assert.Equal(t, 1, dupeCopies("IMG_0001 copy 2.jpg"))
+	assert.Equal(t, 2, dupeCopies("IMG_0001(1)_3f2a9c.jpg"))
+
+	assert.Equal(t, "/mnt/media/b/IMG_0001.jpg",
+		simplestName([]string{"/mnt/media/IMG_0001_3f2a9c.jpg", "/mnt/media/longer/IMG_0001 (1).jpg", "/mnt/media/b/IMG_0001.jpg"}))
+	assert.Equal(t, "/a/IMG_1.jpg", simplestName([]string{"/b/IMG_1.jpg", "/a/IMG_1.jpg", "/a/b/IMG_1.jpg"}))
+}
+
+// createTestDupes indexes 3 copies under dir, backed up if backup, and returns the cache path and copies.
+func createTestDupes(t *testing.T, dir string, backup bool) (string, []string) {
+	names := []string{filepath.Join(dir, "IMG_0001.jpg"), filepath.Join(dir, "IMG_0001(1).jpg"), filepath.Join(dir, "sub", "IMG_0001_3f2a9c.jpg")}
+	os.MkdirAll(filepath.Join(dir, "sub"), 0755)
+	for _, name := range names {
+		os.WriteFile(name, []byte("same content"), 0644)
+	}
+	id, sum, _ := fileHashes(names[0])
+
+	cachePath := t.TempDir()
+	db, err := CreateDb(cachePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, name := range names {
+		_, err := db.Exec("insert into files(name, hostname, id, size, sha256) values(?, 'h', ?, 12, ?)", name, id, sum)
+		assert.NoError(t, err)
+	}
+	if backup {
+		backupName := filepath.Join(t.TempDir(), "IMG_0001.jpg")
+		os.WriteFile(backupName, []byte("same content"), 0644)
+		_, err := db.Exec(`insert into filez(name, id, size, hostname, timemodified, timeborn, timebornsrc, mimetype, mimesubtype, info, sha256)
+                                   values(?, ?, 12, 'h', 0, 0, 'meta', 'image', '', '', ?)`, backupName, id, sum)
+		assert.NoError(t, err)
+	}
+	return cachePath, names
+}
+
+func TestDupes(t *testing.T) {
+	cachePath, names := createTestDupes(t, t.TempDir(), true)
+
+	groups, err := Dupes(cachePath, "h", "")
+	assert.NoError(t, err)
+	if assert.Len(t, groups, 1) {
+		assert.Equal(t, names[0], groups[0].Keep)
+		assert.ElementsMatch(t, names[1:], groups[0].Extra)
+		assert.Equal(t, int64(24), groups[0].Reclaimable)
+	}
+
+	groups, _ = Dupes(cachePath, "h", filepath.Join(filepath.Dir(names[0]), "sub"))
+	assert.Len(t, groups, 0)
+	groups, _ = Dupes(cachePath, "h", filepath.Dir(names[0])+"/")
+	assert.Len(t, groups, 1)
+	groups, _ = Dupes(cachePath, "h", names[0][:len(names[0])-5]) // IMG_0 is no dir
+	assert.Len(t, groups, 0)
+}
+
+func TestDedupe(t *testing.T) {
+	t.Run("hardlink", func(t *testing.T) {
+		cachePath, names := createTestDupes(t, t.TempDir(), true)
+		opt := DedupeOptions{CachePath: cachePath, Hostname: "h", Mode: DedupeHardlink}
+
+		opt.DryRun = true
+		results, err := Dedupe(opt)
+		assert.NoError(t, err)
+		assert.Len(t, results, 2)
+		groups, _ := Dupes(cachePath, "h", "")
+		assert.Equal(t, int64(24), groups[0].Reclaimable)
+
+		opt.DryRun = false
+		results, err = Dedupe(opt)
+		assert.NoError(t, err)
+		for _, r := range results {
+			assert.Equal(t, "hardlink", r.Action)
+			assert.Equal(t, "", r.Reason)
+		}
+		keep, _ := os.Stat(names[0])
+		for _, name := range names[1:] {
+			fi, _ := os.Stat(name)
+			assert.True(t, os.SameFile(keep, fi), name)
+		}
+		groups, _ = Dupes(cachePath, "h", "")
+		assert.Equal(t, int64(0), groups[0].Reclaimable)
+	})
+
+	t.Run("trash", func(t *testing.T) {
+		cachePath, names := createTestDupes(t, t.TempDir(), true)
+		trash := t.TempDir()
+		results, err := Dedupe(DedupeOptions{CachePath: cachePath, Hostname: "h", Mode: DedupeTrash, TrashPath: trash})
+		assert.NoError(t, err)
+		assert.Len(t, results, 2)
+		for _, name := range names[1:] {
+			assert.NoFileExists(t, name)
+			assert.FileExists(t, filepath.Join(trash, name))
+		}
+		assert.FileExists(t, names[0])
+		groups, _ := Dupes(cachePath, "h", "")
+		assert.Len(t, groups, 0)
+	})
+
+	t.Run("not backed up", func(t *testing.T) {
+		cachePath, names := createTestDupes(t, t.TempDir(), false)
+		results, err := Dedupe(DedupeOptions{CachePath: cachePath, Hostname: "h", Mode: DedupeTrash, TrashPath: t.TempDir()})
+		assert.NoError(t, err)
+		for _, r := range results {
+			assert.Equal(t, "skip", r.Action)
+			assert.Equal(t, "not backed up", r.Reason)
+		}
+		assert.FileExists(t, names[1])
+	})
+
+	t.Run("backup changed", func(t *testing.T) {
+		cachePath, names := createTestDupes(t, t.TempDir(), true)
+		groups, _ := Dupes(cachePath, "h", "")
+		os.WriteFile(groups[0].Backup, []byte("rotten bits!"), 0644) // same size
+		results, _ := Dedupe(DedupeOptions{CachePath: cachePath, Hostname: "h", Mode: DedupeTrash, TrashPath: t.TempDir()})
+		for _, r := range results {
+			assert.Equal(t, "skip", r.Action)
+		}
+		assert.FileExists(t, names[1])
+	})
+
+	t.Run("changed", func(t *testing.T) {
+		cachePath, names := createTestDupes(t, t.TempDir(), true)
+		os.WriteFile(names[1], []byte("edited after"), 0644)
+		results, _ := Dedupe(DedupeOptions{CachePath: cachePath, Hostname: "h", Mode: DedupeHardlink})
+		for _, r := range results {
+			if r.Name == names[1] {
+				assert.Equal(t, "skip", r.Action)
+			} else {
+				assert.Equal(t, "hardlink", r.Action)
+			}
+		}
+	})
+}
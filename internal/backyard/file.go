@@ -1,9 +1,11 @@
 package backyard
 
 import (
+	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
@@ -18,9 +20,10 @@ import (
 type TimeBornSrcType string
 
 const (
-	TimeBornSrcMeta TimeBornSrcType = "meta"
-	TimeBornSrcStat TimeBornSrcType = "stat"
-	TimeBornSrcName TimeBornSrcType = "name"
+	TimeBornSrcMeta    TimeBornSrcType = "meta"
+	TimeBornSrcStat    TimeBornSrcType = "stat"
+	TimeBornSrcName    TimeBornSrcType = "name"
+	TimeBornSrcTakeout TimeBornSrcType = "takeout" // json of Google Takeout
 )
 
 type File8 struct {
@@ -35,8 +38,17 @@ type File8 struct {
 	MIMEType    string          // xxx of xxx/yyy
 	MIMESubtype string          // yyy of xxxy/yyy
 	Info        string
-
-	backup_ *File8 //track what's in db
+	TimeZone    string //zone of birth time, as the backup folder dates go
+	PrimaryId   int64  //of the media file a backup'd sidecar follows
+	Sha256      string //sha256 in hex of file content, confirms identity beyond xxh3
+
+	backup_    *File8              //track what's in db
+	conflicts_ []*Conflict         //found when backing up, to record in db
+	albums_    []string            //found when indexing, to record in db
+	meta_      *MediaMeta          //extracted when indexing, to record in db
+	search_    *SearchDoc          //extracted when indexing, to record in db if full-text search is built in
+	links_     map[string]LinkMode //alternate names linked when backing up, to record in db
+	plan_      *PlanEntry          //what backing up would do, in a dry run
 }
 
 func fileStat(fileName string) (error, time.Time, int64) {
@@ -63,19 +75,53 @@ func fileXXH3(fileName string) uint64 {
 	return hash.Sum64()
 }
 
-func NewFileIndex(fileName string) (error, *File8) {
+// fileHashes returns xxh3 and sha256 in hex of the file content, read once.
+func fileHashes(fileName string) (id int64, sum string, err error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return 0, "", err
+	}
+	defer file.Close()
+
+	hash, hashSha256 := xxh3.New(), sha256.New()
+	if _, err := io.Copy(io.MultiWriter(hash, hashSha256), file); err != nil {
+		return 0, "", err
+	}
+	return int64(hash.Sum64()), hex.EncodeToString(hashSha256.Sum(nil)), nil
+}
+
+// sameContent tells if the file content is of id and sha256, which is not checked if unknown.
+func sameContent(fileName string, id int64, sum string) bool {
+	_, same := contentOf(fileName, id, sum)
+	return same
+}
+
+// contentOf returns the xxh3 id of the file content, and if it is of id and sha256, reading the file once.
+func contentOf(fileName string, id int64, sum string) (idFile int64, same bool) {
+	if sum == "" {
+		idFile = int64(fileXXH3(fileName))
+		return idFile, idFile == id
+	}
+	idFile, sumFile, err := fileHashes(fileName)
+	return idFile, err == nil && idFile == id && sumFile == sum
+}
+
+func NewFileIndex(fileName string, loc *time.Location) (error, *File8) {
+	return newFileIndex(fileName, loc, true)
+}
+
+// newFileIndex indexes fileName, with the id by a hash of its content, or if not hash, of its name and stat only.
+func newFileIndex(fileName string, loc *time.Location, hash bool) (error, *File8) {
 	err, mtimeF, sizeF := fileStat(fileName)
 	if err != nil || sizeF == 0 {
 		log.Errorf("NewFileIndex: stat %v err - %v", fileName, err)
 		return err, nil
 	}
 
-	timeLoc, _ := time.LoadLocation("Asia/Chongqing")
-	birthF, birthSrcF := guestTimeBorn(fileName), TimeBornSrcName
+	birthF, birthSrcF := guestTimeBorn(fileName, loc), TimeBornSrcName
 	if birthF.Year() < 1900 || mtimeF.Before(birthF) {
 		birthF, birthSrcF = mtimeF, TimeBornSrcStat
 	}
-	time.Unix(birthF.Unix(), 0).In(timeLoc)
 
 	hostname, err := os.Hostname()
 
@@ -86,6 +132,7 @@ func NewFileIndex(fileName string) (error, *File8) {
 		Hostname:     hostname,
 		TimeBorn:     birthF.Unix(),
 		TimeBornSrc:  birthSrcF,
+		TimeZone:     loc.String(),
 	}
 
 	file, err := os.Open(fileName)
@@ -113,16 +160,20 @@ func NewFileIndex(fileName string) (error, *File8) {
 
 	_, err = file.Seek(0, io.SeekStart)
 	if err != nil {
-		log.Fatalf("NewFileIndex: Seek %v err - %v", fileName, err)
+		log.Errorf("NewFileIndex: Seek %v err - %v", fileName, err)
 		return err, fi
 	}
 
 	//2. hash
-	hash := xxh3.New()
-	if _, err := io.Copy(hash, file); err != nil {
+	if !hash {
+		fi.Id = int64(xxh3.HashString(fmt.Sprintf("%v\x00%v\x00%v", fileName, fi.Size, fi.TimeModified)))
+		return nil, fi
+	}
+	hashXXH3, hashSha256 := xxh3.New(), sha256.New()
+	if _, err := io.Copy(io.MultiWriter(hashXXH3, hashSha256), file); err != nil {
 		log.Errorf("NewFileIndex: Copy for hash %v err - %v", fileName, err)
 	}
-	fi.Id = int64(hash.Sum64())
+	fi.Id, fi.Sha256 = int64(hashXXH3.Sum64()), hex.EncodeToString(hashSha256.Sum(nil))
 
 	return nil, fi
 }
@@ -145,7 +196,7 @@ func Int64ToString(s int64) string {
 }
 func CopyWithStat(src, dest string) (err error) {
 	if err := fs.Copy(src, dest); err != nil {
-		return nil
+		return err
 	}
 	si, err := os.Lstat(src)
 	if err != nil {
@@ -159,6 +210,9 @@ func CopyWithStat(src, dest string) (err error) {
 func buildExifJson(fileName string, et *exiftool.Exiftool) ([]byte, error) {
 	err := errors.New("buildExifJson: non exif existed in " + fileName)
 	var result []byte
+	if et == nil {
+		return result, errors.New("buildExifJson: no exiftool")
+	}
 	fileInfos := et.ExtractMetadata(fileName)
 	for _, fileInfo := range fileInfos {
 		if fileInfo.Err != nil {
@@ -172,13 +226,15 @@ func buildExifJson(fileName string, et *exiftool.Exiftool) ([]byte, error) {
 	return result, err
 }
 
-func guestTimeBorn(fileName string) time.Time {
+// guestTimeBorn guesses birth time from the file name, whose wall clock is read in loc.
+func guestTimeBorn(fileName string, loc *time.Location) time.Time {
 	//try name
 	tname, tbase := TimeFromFileName(fileName), TimeFromFileName(filepath.Base(fileName))
 	if tbase.Year() > 1980 && tbase.Before(tname) {
 		tname = tbase
 	}
-	timeLoc, _ := time.LoadLocation("Asia/Chongqing")
-	tname = time.Unix(tname.Unix(), 0).In(timeLoc)
-	return tname
+	if tname.IsZero() {
+		return tname
+	}
+	return inZone(tname, loc)
 }
@@ -18,7 +18,6 @@ import (
 	"github.com/barasher/go-exiftool"
 	"github.com/karrick/godirwalk"
 
-	"github.com/njhsi/8ackyard/internal/config"
 	"github.com/njhsi/8ackyard/internal/mutex"
 	"github.com/photoprism/photoprism/pkg/fs"
 )
@@ -48,81 +47,114 @@ func (ind *Index) initStoreIndex(storePath string) error {
 	return nil
 }
 
-// Start indexes media files in the "originals" folder.
-func (ind *Index) Start(opt IndexOptions) fs.Done {
+// fileLookup finds indexed files of a host in db one by one, so that memory stays flat however big the library is.
+type fileLookup struct {
+	hostname string
+	stmt     *sql.Stmt
+}
+
+func newFileLookup(db *sql.DB, hostname string) (*fileLookup, error) {
+	stmt, err := db.Prepare("select size, timemodified, id from files where name=? and hostname=?")
+	if err != nil {
+		return nil, err
+	}
+
+	return &fileLookup{hostname: hostname, stmt: stmt}, nil
+}
+
+// Find returns the indexed file of name, or nil if not indexed.
+func (l *fileLookup) Find(name string) *File8 {
+	fi := &File8{Name: name, Hostname: l.hostname}
+	if err := l.stmt.QueryRow(name, l.hostname).Scan(&fi.Size, &fi.TimeModified, &fi.Id); err != nil {
+		if err != sql.ErrNoRows {
+			log.Warnf("index: lookup %v err=%v", name, err)
+		}
+		return nil
+	}
+
+	return fi
+}
+
+func (l *fileLookup) Close() {
+	l.stmt.Close()
+}
+
+// Start indexes media files in the "originals" folder, and returns the number of files found.
+// memory stays flat however many files there are, as walked files are looked up in db one by one, not kept.
+func (ind *Index) Start(opt IndexOptions) (found int) {
 	defer func() {
 		if r := recover(); r != nil {
 			log.Errorf("index: %s (panic)\nstack: %s", r, debug.Stack())
 		}
 	}()
 
-	done := make(fs.Done)
+	done := make(fs.Done) // symlink targets walked, by fs.SkipWalk, not to walk them twice
 
 	originalsPath := opt.Path
 	optionsPath := opt.Path
 
 	if !fs.PathExists(optionsPath) {
 		log.Errorf("index: %s does not exist", optionsPath)
-		return done
+		return found
 	}
 
 	if len(opt.Hostname) == 0 {
 		opt.Hostname, _ = os.Hostname()
 	}
+	if opt.TimeZones == nil {
+		opt.TimeZones, _ = NewTimeZones(DefaultTimeZone)
+	}
+	if opt.Sidecars == nil {
+		opt.Sidecars = NewSidecars(DefaultSidecars)
+	}
+	if opt.Takeout { // backed up next to their media, not added to the caller's map
+		opt.Sidecars = opt.Sidecars.With(".json")
+	}
 
-	dbName := opt.CachePath + "/indexed.db"
-	dbExisted := true
-	if _, err := os.Stat(dbName); errors.Is(err, iofs.ErrNotExist) {
-		dbExisted = false
+	var db *sql.DB
+	var err error
+	if opt.Plan != nil {
+		defer opt.Plan.close()
+		db, err = opt.Plan.openDb(opt.CachePath)
+	} else {
+		db, err = CreateDb(opt.CachePath)
 	}
-	db, err := sql.Open("sqlite3", dbName)
 	if err != nil {
-		log.Errorf("db failed: Open %v", err)
-		return done
+		log.Errorf("index: %v", err)
+		return found
 	}
 	defer db.Close()
-	if !dbExisted {
-		// id: xxhash h3 64bit. INT rather than INTEGER of sqlite, constraints non-auto-incremental as primary key needs.
-		sqlStmt := `
-               create table filez (id int not null, name text not null, hostname text,
-                                   size integer not null, timemodified integer, timeborn integer, timebornsrc text,
-                                   mimetype text, mimesubtype text, info text,
-                                   primary key(id));
-               create table files (name text not null, hostname text not null, id int not null,
-                                   size integer not null, timemodified integer, timeborn integer, timebornsrc text,
-                                   mimetype text, mimesubtype text, info text,
-                                   primary key(name, hostname));
-               delete from filez;
-               delete from files;
-               `
-		_, err = db.Exec(sqlStmt)
-		if err != nil {
-			log.Fatalf("db failed: Exec %q: %s", err, sqlStmt)
-			return done
-		}
-	}
 
-	mapFiles := make(map[string]*File8) //TODO: instead, query db when neccessary
-	dbtx, err := db.Begin()
-	dbrows, err := dbtx.Query("select name,size,timemodified,id from files where hostname=?", opt.Hostname)
-	for dbrows.Next() {
-		fi := &File8{}
-		if err := dbrows.Scan(&fi.Name, &fi.Size, &fi.TimeModified, &fi.Id); err != nil {
-			log.Fatalf("dbrows.Scan :%v", err)
-		}
-		mapFiles[fi.Name] = fi
+	lookup, err := newFileLookup(db, opt.Hostname)
+	if err != nil {
+		log.Errorf("index: %v", err)
+		return found
 	}
-	dbtx.Commit()
-	dbtx = nil
-	dbrows.Close()
-	log.Infof("index: loaded %v files of host[%v] in db", len(mapFiles), opt.Hostname)
+	defer lookup.Close()
 
 	if err := mutex.MainWorker.Start(); err != nil {
 		log.Errorf("index: %s", err.Error())
-		return done
+		return found
 	}
 	defer mutex.MainWorker.Stop()
 
+	// backfills and the full-text index, if fts5 is in the build, by full runs only, not on every batch of watch
+	search := true
+	if opt.Files == nil {
+		if opt.Plan == nil || !opt.Plan.NoHash {
+			backfillHashes(opt, db)
+		}
+		if err := createSearchIndex(db); err != nil {
+			search = false
+			if err != errNoFts5 {
+				log.Warnf("index: no full-text search index - %v", err)
+			}
+		}
+		backfillMeta(opt, db, search)
+	} else {
+		search = searchIndexed(db)
+	}
+
 	jobs := make(chan IndexJob)
 	chDb := make(chan *File8, 50)
 
@@ -138,20 +170,24 @@ func (ind *Index) Start(opt IndexOptions) fs.Done {
 			et, err := exiftool.NewExiftool()
 			if err != nil {
 				et = nil
-				log.Warnf("index: error when intializing exiftool: %v\n", err)
+				log.Warnf("index: error when intializing exiftool, using native metadata instead: %v", err)
 			} else {
 				defer et.Close()
 			}
-			IndexWorker(jobs, et) // HLc
+			extractors := NewExtractors(et, opt.CachePath, opt.Force)
+			if opt.Plan != nil {
+				extractors = extractors.dryRun(opt.Plan.cachePath)
+			}
+			IndexWorker(jobs, extractors) // HLc
 			wg.Done()
 		}()
 
 	}
 	chDbWait := make(chan bool)
 	go func() { //db
-		sqlQuery := `select id, size, hostname, timemodified, timeborn, timebornsrc, mimetype, mimesubtype, info from files where name=? and hostname=?`
-		sqlInsert := `insert into files(name, id, size, hostname, timemodified, timeborn, timebornsrc, mimetype, mimesubtype, info) values(?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
-		sqlDelete := `delete from files where name=?`
+		sqlQuery := `select id, size, hostname, timemodified, timeborn, timebornsrc, mimetype, mimesubtype, info, timezone from files where name=? and hostname=?`
+		sqlInsert := `insert into files(name, id, size, hostname, timemodified, timeborn, timebornsrc, mimetype, mimesubtype, info, timezone, sha256) values(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+		sqlDelete := `delete from files where name=? and hostname=?`
 		var dbtx1 *sql.Tx
 		var sInsert *sql.Stmt
 		var sDelete *sql.Stmt
@@ -161,18 +197,16 @@ func (ind *Index) Start(opt IndexOptions) fs.Done {
 			if dbtx1 == nil {
 				dbtx1, _ = db.Begin()
 			}
-			if f, ok := mapFiles[fi.Name]; ok {
-				log.Warnf("index db: conflicted path=%v, updating in db with id=%v to id=%v", fi.Name, f.Id, fi.Id)
-				fiOld := File8{}
-				dbRow := dbtx1.QueryRow(sqlQuery, fi.Name, fi.Hostname)
-				if err := dbRow.Scan(&fiOld.Id, &fiOld.Size, &fiOld.Hostname, &fiOld.TimeModified, &fiOld.TimeBorn, &fiOld.TimeBornSrc,
-					&fiOld.MIMEType, &fiOld.MIMESubtype, &fiOld.Info); err == nil {
-					fi.Info = fmt.Sprintf("\fi=%+v NOW=%v", fiOld, time.Now()) + fi.Info //checkpoint
-				}
+			fiOld := File8{}
+			dbRow := dbtx1.QueryRow(sqlQuery, fi.Name, fi.Hostname)
+			if err := dbRow.Scan(&fiOld.Id, &fiOld.Size, &fiOld.Hostname, &fiOld.TimeModified, &fiOld.TimeBorn, &fiOld.TimeBornSrc,
+				&fiOld.MIMEType, &fiOld.MIMESubtype, &fiOld.Info, &fiOld.TimeZone); err == nil {
+				log.Warnf("index db: conflicted path=%v, updating in db with id=%v to id=%v", fi.Name, fiOld.Id, fi.Id)
+				fi.Info = fmt.Sprintf("\fi=%+v NOW=%v", fiOld, time.Now()) + fi.Info //checkpoint
 				if sDelete == nil {
 					sDelete, _ = dbtx1.Prepare(sqlDelete)
 				}
-				if _, err := sDelete.Exec(fi.Name); err != nil {
+				if _, err := sDelete.Exec(fi.Name, fi.Hostname); err != nil {
 					log.Warnf("index db: sDelete.Exec err=%v, fi=%v", err, fi)
 				}
 			}
@@ -182,9 +216,24 @@ func (ind *Index) Start(opt IndexOptions) fs.Done {
 			}
 			if _, err := sInsert.Exec(fi.Name, fi.Id, fi.Size, fi.Hostname,
 				fi.TimeModified, fi.TimeBorn, fi.TimeBornSrc,
-				fi.MIMEType, fi.MIMESubtype, fi.Info); err != nil {
+				fi.MIMEType, fi.MIMESubtype, fi.Info, fi.TimeZone, fi.Sha256); err != nil {
 				log.Warnf("index db: sInsert.Exec err=%v, fi=%v", err, fi)
 			}
+			if search && fi.MIMEType != MIMETypeSidecar {
+				if err := saveSearchDoc(dbtx1, fi.Id, fi.search_); err != nil {
+					log.Warnf("index db: media_fts of %v err=%v", fi.Name, err)
+				}
+			}
+			if fi.meta_ != nil {
+				if err := saveMediaMeta(dbtx1, fi.meta_); err != nil {
+					log.Warnf("index db: media_meta of %v err=%v", fi.Name, err)
+				}
+			}
+			for _, album := range fi.albums_ {
+				if _, err := dbtx1.Exec("insert or ignore into albums(id, album) values(?, ?)", fi.Id, album); err != nil {
+					log.Warnf("index db: album %v of %v err=%v", album, fi.Name, err)
+				}
+			}
 
 			fcount = fcount + 1
 			if fcount%100 == 0 {
@@ -209,9 +258,6 @@ func (ind *Index) Start(opt IndexOptions) fs.Done {
 		chDbWait <- true
 	}()
 
-	config.CacheDir = opt.CachePath
-	config.FileRoot = opt.Path
-
 	filesIndexed := 0
 	ignore := fs.NewIgnoreList(fs.IgnoreFile, false, false) //!! do not ignore hidden files
 
@@ -223,60 +269,65 @@ func (ind *Index) Start(opt IndexOptions) fs.Done {
 		log.Infof(`index: ignored "%s"`, fs.RelName(fileName, originalsPath))
 	}
 
-	err = godirwalk.Walk(optionsPath, &godirwalk.Options{
-		ErrorCallback: func(fileName string, err error) godirwalk.ErrorAction {
-			log.Errorf("index: Walk an error=%s, @%v ", err, strings.Replace(err.Error(), originalsPath, "", 1))
-			return godirwalk.SkipNode
-		},
-		Callback: func(fileName string, info *godirwalk.Dirent) error {
-			if mutex.MainWorker.Canceled() {
-				return errors.New("indexing canceled")
-			}
+	walkFn := func(fileName string, info *godirwalk.Dirent) error {
+		if mutex.MainWorker.Canceled() {
+			return errors.New("indexing canceled")
+		}
 
-			isDir := info.IsDir()
-			isSymlink := info.IsSymlink()
-			relName := fs.RelName(fileName, originalsPath)
-			skip, result := fs.SkipWalk(fileName, isDir, isSymlink, done, ignore)
+		isDir := info.IsDir()
+		isSymlink := info.IsSymlink()
+		relName := fs.RelName(fileName, originalsPath)
+		skip, result := fs.SkipWalk(fileName, isDir, isSymlink, done, ignore)
 
-			log.Infof("index: Walk got a file(skip=%v) - %v", skip, fileName)
-			if skip {
-				if (isSymlink || isDir) && result != filepath.SkipDir {
-					log.Infof("index: added folder /%s", fileName)
-				}
-
-				if isDir {
-					log.Infof("index.folder filePath /%s", relName)
-				}
+		log.Infof("index: Walk got a file(skip=%v) - %v", skip, fileName)
+		if skip {
+			if (isSymlink || isDir) && result != filepath.SkipDir {
+				log.Infof("index: added folder /%s", fileName)
+			}
 
-				return result
+			if isDir {
+				log.Infof("index.folder filePath /%s", relName)
 			}
 
-			done[fileName] = fs.Found
+			return result
+		}
+
+		found = found + 1
 
-			if fi, ok := mapFiles[fileName]; ok == true {
-				if err, mtime, size := fileStat(fileName); err == nil {
-					mtime_ts := mtime.Unix()
-					if fi.Size == size && fi.TimeModified == mtime_ts { //TODO: strict option to check ID
-						done[fileName] = fs.Processed
-						log.Infof("index: Walk - file=[%v] with id=[%v] was in db, not processing..", fileName, fi.Id)
-					}
+		unchanged := false
+		if fi := lookup.Find(fileName); fi != nil && !opt.Force {
+			if err, mtime, size := fileStat(fileName); err == nil {
+				mtime_ts := mtime.Unix()
+				if fi.Size == size && fi.TimeModified == mtime_ts { //TODO: strict option to check ID
+					unchanged = true
+					log.Infof("index: Walk - file=[%v] with id=[%v] was in db, not processing..", fileName, fi.Id)
 				}
 			}
-			if done[fileName] != fs.Processed {
-				jobs <- IndexJob{
-					FileName: fileName,
-					IndexOpt: opt,
-					Ind:      ind,
-					ChDB:     chDb,
-				}
+		}
+		if !unchanged {
+			jobs <- IndexJob{
+				FileName: fileName,
+				IndexOpt: opt,
+				Ind:      ind,
+				ChDB:     chDb,
 			}
-			done[fileName] = fs.Processed
+		}
 
-			return nil
-		},
-		Unsorted:            false,
-		FollowSymbolicLinks: true,
-	})
+		return nil
+	}
+	if opt.Files != nil {
+		err = indexFiles(opt.Files, walkFn)
+	} else {
+		err = godirwalk.Walk(optionsPath, &godirwalk.Options{
+			ErrorCallback: func(fileName string, err error) godirwalk.ErrorAction {
+				log.Errorf("index: Walk an error=%s, @%v ", err, strings.Replace(err.Error(), originalsPath, "", 1))
+				return godirwalk.SkipNode
+			},
+			Callback:            walkFn,
+			Unsorted:            false,
+			FollowSymbolicLinks: true,
+		})
+	}
 
 	close(jobs)
 
@@ -289,6 +340,13 @@ func (ind *Index) Start(opt IndexOptions) fs.Done {
 		log.Error(err.Error())
 	}
 
+	if opt.Cleanup && err == nil && !mutex.MainWorker.Canceled() {
+		removed := cleanupFiles(opt, db)
+		if opt.Cleaned != nil {
+			*opt.Cleaned = removed
+		}
+	}
+
 	if filesIndexed > 0 {
 		log.Infof("index.updating /%d", filesIndexed)
 		// Update precalculated photo and file counts.
@@ -305,32 +363,204 @@ func (ind *Index) Start(opt IndexOptions) fs.Done {
 	defer ind.mutex.RUnlock()
 	runtime.GC()
 	log.Infof("index: Start() finished.. mainworker canceld %v", mutex.MainWorker.Canceled())
-	return done
+	return found
+}
+
+// indexFiles walks only files of names, not dirs, as if found by walking.
+func indexFiles(names []string, walkFn godirwalk.WalkFunc) error {
+	for _, name := range names {
+		dirent, err := godirwalk.NewDirent(name)
+		if err != nil {
+			log.Warnf("index: %v", err)
+			continue
+		}
+		if dirent.IsDir() {
+			continue
+		}
+		if err := walkFn(name, dirent); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cleanupFiles removes index entries of the host, whose files under the indexed path do not exist anymore,
+// or only those of opt.CleanupFiles and under them, if not nil.
+func cleanupFiles(opt IndexOptions, db *sql.DB) (removed []string) {
+	roots := opt.CleanupFiles
+	if roots == nil {
+		roots = []string{opt.Path}
+	}
+	for _, root := range roots {
+		prefix := strings.TrimSuffix(root, "/") + "/"
+		dbrows, err := db.Query("select name from files where hostname=? and (name=? or substr(name, 1, length(?))=?)",
+			opt.Hostname, root, prefix, prefix)
+		if err != nil {
+			log.Errorf("index cleanup: Query %v", err)
+			return removed
+		}
+		for dbrows.Next() {
+			var name string
+			if err := dbrows.Scan(&name); err != nil {
+				log.Errorf("index cleanup: Scan %v", err)
+				continue
+			}
+			if _, err := os.Lstat(name); errors.Is(err, iofs.ErrNotExist) {
+				removed = append(removed, name)
+			}
+		}
+		dbrows.Close()
+	}
+
+	search := searchIndexed(db)
+	dbtx, err := db.Begin()
+	if err != nil {
+		log.Errorf("index cleanup: Begin %v", err)
+		return nil
+	}
+	for _, name := range removed {
+		if _, err := dbtx.Exec("delete from files where name=? and hostname=?", name, opt.Hostname); err != nil {
+			log.Warnf("index cleanup: delete %v err=%v", name, err)
+		}
+		log.Infof("index cleanup: removed orphan entry %v", name)
+	}
+	if _, err := dbtx.Exec(`delete from media_meta where id not in (select id from files) and id not in (select id from filez)`); err != nil {
+		log.Warnf("index cleanup: delete orphan media_meta err=%v", err)
+	}
+	if search {
+		if _, err := dbtx.Exec(`delete from media_fts where rowid not in (select id from files) and rowid not in (select id from filez)`); err != nil {
+			log.Warnf("index cleanup: delete orphan media_fts err=%v", err)
+		}
+	}
+	if err := dbtx.Commit(); err != nil {
+		log.Errorf("index cleanup: Commit %v", err)
+		return nil
+	}
+
+	if opt.Plan == nil { // links stay on disk in a dry run
+		if err := dropLinks(db, orphanLinks(db)); err != nil {
+			log.Warnf("index cleanup: drop orphan links err=%v", err)
+		}
+	}
+
+	log.Infof("index cleanup: removed %v orphan entries of host[%v] under %v", len(removed), opt.Hostname, roots)
+	return removed
 }
 
 func backup_start(opt IndexOptions, db *sql.DB) {
-	//collect of distinct files to backup
+	backupOpt := BackupOptions{
+		OriginalsPath:   opt.Path,
+		BackupPath:      opt.BackupPath,
+		CachePath:       opt.CachePath,
+		Layout:          opt.Layout,
+		Documents:       opt.Documents,
+		DocumentsLayout: opt.DocumentsLayout,
+		NumWorkers:      opt.NumWorkers,
+		AltNames:        opt.AltNames,
+		Plan:            opt.Plan,
+	}
+	if backupOpt.Layout == nil {
+		backupOpt.Layout, _ = NewLayout(DefaultLayout)
+	}
+	if backupOpt.DocumentsLayout == nil {
+		backupOpt.DocumentsLayout, _ = NewLayout(DefaultDocumentsLayout)
+	}
+
+	var only map[int64]bool // ids of opt.Files, if only they are indexed
+	if opt.Files != nil {
+		only = make(map[int64]bool)
+		for _, name := range opt.Files {
+			for _, id := range backupIds(db, "select id from files where name=? and hostname=?", name, opt.Hostname) {
+				only[id] = true
+			}
+		}
+	}
+
+	//media and documents first, so that sidecars know where their primaries are back'd up
+	ids := backupIds(db, "select distinct id from files where hostname=? and mimetype!=?", opt.Hostname, MIMETypeSidecar)
+	ids = onlyIds(ids, only)
+	idsSidecar := backupIds(db, `select distinct id from files where hostname=? and mimetype=?
+                             and id not in (select id from files where hostname=? and mimetype!=?)`,
+		opt.Hostname, MIMETypeSidecar, opt.Hostname, MIMETypeSidecar)
+	idsSidecar = onlyIds(idsSidecar, only)
+
+	// resume an interrupted run, its copies left half way are of no use.
+	// by full runs only, not to walk the backup on every batch of watch
+	planned := append(append([]int64{}, ids...), idsSidecar...)
+	if err := journalPrune(db, opt.Hostname); err != nil {
+		log.Errorf("index: backup journal err=%v", err)
+	}
+	var done map[int64]bool
+	if opt.Files == nil {
+		var interrupted bool
+		done, interrupted = journalDone(db)
+		if interrupted && opt.Plan == nil {
+			removed := removeBackupTmps(opt.BackupPath)
+			log.Warnf("index: backup resumes an interrupted run, %v files done already, %v temporary copies removed", len(done), len(removed))
+		}
+	}
+	if err := journalPlan(db, planned); err != nil {
+		log.Errorf("index: backup journal err=%v", err)
+	}
+
+	ids = exceptIds(ids, done)
+	log.Infof("index: backup starts, %v distinct files in db", len(ids))
+	if !backupFiles(opt, backupOpt, db, ids) {
+		log.Warnf("index: backup canceled, to resume on the next run")
+		return
+	}
+
+	idsSidecar = exceptIds(idsSidecar, done)
+	log.Infof("index: backup of sidecars starts, %v distinct sidecars in db", len(idsSidecar))
+	if !backupFiles(opt, backupOpt, db, idsSidecar) {
+		log.Warnf("index: backup canceled, to resume on the next run")
+		return
+	}
+
+	if opt.Files == nil {
+		planned = nil // all, by a full run
+	}
+	if err := journalClear(db, planned); err != nil {
+		log.Errorf("index: backup journal err=%v", err)
+	}
+}
+
+// onlyIds returns ids in only, or all of them if only is nil.
+func onlyIds(ids []int64, only map[int64]bool) []int64 {
+	if only == nil {
+		return ids
+	}
+	kept := make([]int64, 0, len(only))
+	for _, id := range ids {
+		if only[id] {
+			kept = append(kept, id)
+		}
+	}
+	return kept
+}
+
+// backupIds collects distinct ids of files to backup.
+func backupIds(db *sql.DB, query string, args ...interface{}) []int64 {
 	ids := make([]int64, 0)
-	dbtx, _ := db.Begin()
-	dbrows, _ := dbtx.Query("select distinct id from files where hostname=?", opt.Hostname)
+	dbrows, err := db.Query(query, args...)
+	if err != nil {
+		log.Errorf("index: backup Query %v", err)
+		return ids
+	}
+	defer dbrows.Close()
 	for dbrows.Next() {
 		var id int64
 		if err := dbrows.Scan(&id); err == nil {
 			ids = append(ids, id)
 		}
 	}
-	dbtx.Commit()
-	dbtx = nil
-	log.Infof("index: backup starts, %v distinct files in db", len(ids))
-
-	//collect of files back'd up and existed in db ?
+	return ids
+}
 
-	backupOpt := BackupOptions{
-		OriginalsPath: opt.Path,
-		BackupPath:    opt.BackupPath,
-		CachePath:     opt.CachePath,
-		NumWorkers:    opt.NumWorkers,
-	}
+// backupFiles backs up ids, recording each job in the journal, done in the same transaction as filez once backed up.
+// it stops sending jobs once mutex.MainWorker is canceled, and returns false if so.
+func backupFiles(opt IndexOptions, backupOpt BackupOptions, db *sql.DB, ids []int64) bool {
+	var dbtx *sql.Tx
 
 	jobs := make(chan *BackupJob)
 	chDb := make(chan *File8, 50)
@@ -346,21 +576,27 @@ func backup_start(opt IndexOptions, db *sql.DB) {
 	}
 
 	//load the backup jobs
-	sqlQueryFiles := `select name, hostname, size, timemodified, timeborn, timebornsrc, mimetype, mimesubtype, info from files where id=? and hostname=?`
-	sqlQueryFilez := `select name, hostname, size, timemodified, timeborn, timebornsrc, mimetype, mimesubtype, info from filez where id=?` //existed backup
-	sqlInsertFilez := `insert into filez(name, id, size, hostname, timemodified, timeborn, timebornsrc, mimetype, mimesubtype, info) values(?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	sqlQueryFiles := `select name, hostname, size, timemodified, timeborn, timebornsrc, mimetype, mimesubtype, info, timezone, sha256 from files where id=? and hostname=?`
+	sqlQueryFilez := `select name, hostname, size, timemodified, timeborn, timebornsrc, mimetype, mimesubtype, info, timezone, sha256 from filez where id=?` //existed backup
+	sqlInsertFilez := `insert into filez(name, id, size, hostname, timemodified, timeborn, timebornsrc, mimetype, mimesubtype, info, timezone, primaryid, sha256) values(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 	sqlDeleteFilez := `delete from filez where id=?`
 	var sInsertFilez, sDeleteFilez *sql.Stmt
 
 	var bcount, jcount int
 	var job *BackupJob
+	total, canceled := len(ids), false
 	bfm := NewBackupFsMutex()
-	for bcount < len(ids) {
+	for bcount < total {
 		if dbtx == nil {
 			dbtx, _ = db.Begin()
 		}
 
-		if job == nil && jcount < len(ids) {
+		if job == nil && jcount < total && mutex.MainWorker.Canceled() {
+			log.Warnf("backup: canceled, waiting for %v jobs going on", jcount-bcount)
+			total, canceled = jcount, true
+			continue
+		}
+		if job == nil && jcount < total {
 			id := ids[jcount]
 			job = &BackupJob{
 				Id:        id,
@@ -372,15 +608,23 @@ func backup_start(opt IndexOptions, db *sql.DB) {
 			for rows.Next() {
 				fi := &File8{Id: id}
 				if err := rows.Scan(&fi.Name, &fi.Hostname, &fi.Size, &fi.TimeModified, &fi.TimeBorn, &fi.TimeBornSrc,
-					&fi.MIMEType, &fi.MIMESubtype, &fi.Info); err == nil {
+					&fi.MIMEType, &fi.MIMESubtype, &fi.Info, &fi.TimeZone, &fi.Sha256); err == nil {
 					job.Files = append(job.Files, fi)
 				}
 			}
+			rows.Close()
+			job.Accepted = conflictAccepted(dbtx, id)
+			job.Links = loadLinks(dbtx, id)
+			for _, fi := range job.Files {
+				if fi.MIMEType == MIMETypeSidecar && job.Sidecar == nil {
+					job.Sidecar = findSidecarOf(dbtx, fi)
+				}
+			}
 
 			f8 := &File8{Id: id} //back'd up
 			row := dbtx.QueryRow(sqlQueryFilez, id)
 			if err := row.Scan(&f8.Name, &f8.Hostname, &f8.Size, &f8.TimeModified, &f8.TimeBorn, &f8.TimeBornSrc,
-				&f8.MIMEType, &f8.MIMESubtype, &f8.Info); err == nil {
+				&f8.MIMEType, &f8.MIMESubtype, &f8.Info, &f8.TimeZone, &f8.Sha256); err == nil {
 				job.BackFile = f8
 			} else {
 				//				log.Warnf("index: Backup : query for job.BackFile(id=%v) failed - %v", id, err)
@@ -392,6 +636,9 @@ func backup_start(opt IndexOptions, db *sql.DB) {
 			select {
 			case jobs <- job:
 				log.Infof("backup: select sent job.id=%v, b=%v,j=%v", job.Id, bcount, jcount)
+				if err := journalMark(dbtx, job.Id, JournalRunning); err != nil {
+					log.Warnf("backup db: journalMark err=%v, id=%v", err, job.Id)
+				}
 				jcount = jcount + 1
 				job = nil
 			case fb = <-chDb:
@@ -399,13 +646,21 @@ func backup_start(opt IndexOptions, db *sql.DB) {
 			}
 		}
 
-		if jcount == len(ids) && fb == nil {
+		if jcount == total && fb == nil {
 			log.Infof("backup: select-no got fb %+v, b=%v,j=%v", fb, bcount, jcount)
 			fb = <-chDb
 		}
 		if fb != nil {
 			bcount = bcount + 1
 			log.Infof("backup: got fb %+v, bcount=%v", fb, bcount)
+			if backupOpt.Plan != nil {
+				backupOpt.Plan.add(fb)
+			}
+			for _, c := range fb.conflicts_ {
+				if err := recordConflict(dbtx, c); err != nil {
+					log.Errorf("backup db: recordConflict err=%v, conflict=%+v", err, c)
+				}
+			}
 			if fb.Size == 0 { // non-backup, just count it on
 				continue
 			}
@@ -422,15 +677,24 @@ func backup_start(opt IndexOptions, db *sql.DB) {
 
 			}
 			if _, err := sInsertFilez.Exec(fb.Name, fb.Id, fb.Size, fb.Hostname, fb.TimeModified, fb.TimeBorn, fb.TimeBornSrc,
-				fb.MIMEType, fb.MIMESubtype, fb.Info); err != nil {
+				fb.MIMEType, fb.MIMESubtype, fb.Info, fb.TimeZone, fb.PrimaryId, fb.Sha256); err != nil {
 				log.Warnf("backup db: sInsert.Exec err=%v, fi=%v", err, fb)
+			} else if fb.Name != "" { // landed in filez, not skipped, quarantined or failed to copy, which the next run retries
+				if err := journalMark(dbtx, fb.Id, JournalDone); err != nil {
+					log.Warnf("backup db: journalMark err=%v, id=%v", err, fb.Id)
+				}
+			}
+			if fb.links_ != nil {
+				if err := saveLinks(dbtx, fb.Id, fb.links_); err != nil {
+					log.Warnf("backup db: saveLinks err=%v, fi=%v", err, fb)
+				}
 			}
 
 		}
 
 		if bcount%100 == 0 {
 			if err := dbtx.Commit(); err != nil {
-				log.Fatalf("backup db: Commit failed %v", err)
+				log.Errorf("backup db: Commit failed %v", err)
 			}
 			dbtx = nil
 			sDeleteFilez = nil
@@ -448,4 +712,5 @@ func backup_start(opt IndexOptions, db *sql.DB) {
 	close(jobs)
 	wg.Wait()
 	close(chDb)
+	return !canceled
 }
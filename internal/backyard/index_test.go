@@ -0,0 +1,209 @@
+package backyard
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// createTestFiles creates a db in a temp dir with n indexed files of host "h".
+func createTestFiles(tb testing.TB, n int) *sql.DB {
+	db, err := CreateDb(tb.TempDir())
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	dbtx, _ := db.Begin()
+	stmt, _ := dbtx.Prepare("insert into files(name, hostname, id, size, timemodified) values(?, 'h', ?, ?, ?)")
+	for i := 0; i < n; i++ {
+		if _, err := stmt.Exec(fmt.Sprintf("/originals/%06d/IMG_%06d.jpg", i/1000, i), i, 1000+i, 1600000000+i); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	stmt.Close()
+	if err := dbtx.Commit(); err != nil {
+		tb.Fatal(err)
+	}
+
+	return db
+}
+
+func TestFileLookup(t *testing.T) {
+	db := createTestFiles(t, 10)
+	defer db.Close()
+
+	lookup, err := newFileLookup(db, "h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lookup.Close()
+
+	t.Run("indexed", func(t *testing.T) {
+		fi := lookup.Find("/originals/000000/IMG_000003.jpg")
+		if assert.NotNil(t, fi) {
+			assert.Equal(t, int64(3), fi.Id)
+			assert.Equal(t, int64(1003), fi.Size)
+			assert.Equal(t, int64(1600000003), fi.TimeModified)
+			assert.Equal(t, "h", fi.Hostname)
+		}
+	})
+
+	t.Run("not indexed", func(t *testing.T) {
+		assert.Nil(t, lookup.Find("/originals/000000/IMG_000010.jpg"))
+	})
+
+	t.Run("other host", func(t *testing.T) {
+		other, err := newFileLookup(db, "x")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer other.Close()
+
+		assert.Nil(t, other.Find("/originals/000000/IMG_000003.jpg"))
+	})
+}
+
+func TestCleanup(t *testing.T) {
+	dir, cachePath := t.TempDir(), t.TempDir()
+	root, sibling := filepath.Join(dir, "b"), filepath.Join(dir, "bc")
+	kept, gone, siblingGone := filepath.Join(root, "kept.jpg"), filepath.Join(root, "sub", "gone.jpg"), filepath.Join(sibling, "gone.jpg")
+	os.MkdirAll(root, 0755)
+	os.WriteFile(kept, []byte("kept"), 0644)
+
+	db, err := CreateDb(cachePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, name := range []string{gone, siblingGone} {
+		_, err := db.Exec("insert into files(name, hostname, id, size, timemodified, sha256) values(?, 'h', ?, 4, 1560333010, 'x')", name, i+1)
+		assert.NoError(t, err)
+	}
+	db.Close()
+
+	var cleaned []string
+	NewIndex().Start(IndexOptions{Path: root, CachePath: cachePath, Hostname: "h", NumWorkers: 1, Cleanup: true, Cleaned: &cleaned})
+	assert.Equal(t, []string{gone}, cleaned)
+
+	db, err = OpenDb(cachePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var names []string
+	rows, err := db.Query("select name from files where hostname='h' order by name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rows.Next() {
+		var name string
+		rows.Scan(&name)
+		names = append(names, name)
+	}
+	rows.Close()
+	assert.Equal(t, []string{kept, siblingGone}, names, "%v is not under %v", sibling, root)
+
+	t.Run("only files", func(t *testing.T) { // removed while watched
+		gone := []string{filepath.Join(root, "a.jpg"), filepath.Join(root, "d", "b.jpg"), filepath.Join(root, "d", "e", "c.jpg"), filepath.Join(root, "f.jpg")}
+		for i, name := range gone {
+			_, err := db.Exec("insert into files(name, hostname, id, size, timemodified, sha256) values(?, 'h', ?, 4, 1560333010, 'x')", name, 10+i)
+			assert.NoError(t, err)
+		}
+		removed := cleanupFiles(IndexOptions{Path: root, Hostname: "h", CleanupFiles: []string{gone[0], filepath.Join(root, "d")}}, db)
+		assert.ElementsMatch(t, gone[:3], removed, "the file and those under the dir")
+
+		var n int
+		db.QueryRow("select count(*) from files where name=?", gone[3]).Scan(&n)
+		assert.Equal(t, 1, n, "not checked")
+	})
+}
+
+// BenchmarkFileLookup checks 1000 walked files against catalogs of growing size.
+// B/op and allocs/op stay the same whatever the catalog size, as nothing is preloaded.
+func BenchmarkFileLookup(b *testing.B) {
+	for _, n := range []int{1000, 10000, 100000} {
+		b.Run(fmt.Sprintf("catalog=%d", n), func(b *testing.B) {
+			db := createTestFiles(b, n)
+			defer db.Close()
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				lookup, err := newFileLookup(db, "h")
+				if err != nil {
+					b.Fatal(err)
+				}
+				for j := 0; j < 1000; j++ {
+					k := (j * 7919) % n
+					if fi := lookup.Find(fmt.Sprintf("/originals/%06d/IMG_%06d.jpg", k/1000, k)); fi == nil {
+						b.Fatalf("file %d not found", k)
+					}
+				}
+				lookup.Close()
+			}
+		})
+	}
+}
+
+// createTestTree creates n files in dirs of 100 under a temp dir, and returns it.
+func createTestTree(tb testing.TB, n int) string {
+	root := tb.TempDir()
+	for i := 0; i < n; i++ {
+		name := filepath.Join(root, fmt.Sprintf("%04d", i/100), fmt.Sprintf("notes_%06d.txt", i))
+		if i%100 == 0 {
+			os.MkdirAll(filepath.Dir(name), 0755)
+		}
+		if err := os.WriteFile(name, []byte(fmt.Sprintf("notes %d", i)), 0644); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	return root
+}
+
+// BenchmarkIndexStart walks trees of growing size, indexed already, as by a daily run.
+// peak-live-B, the live heap sampled during the walk, stays about the same whatever the tree size,
+// as walked files are not kept.
+func BenchmarkIndexStart(b *testing.B) {
+	for _, n := range []int{1000, 10000, 50000} {
+		b.Run(fmt.Sprintf("files=%d", n), func(b *testing.B) {
+			root, cachePath := createTestTree(b, n), b.TempDir()
+			opt := IndexOptions{Path: root, CachePath: cachePath, Hostname: "h", NumWorkers: 4}
+			if found := NewIndex().Start(opt); found != n {
+				b.Fatalf("%v files found of %v", found, n)
+			}
+
+			var peak uint64
+			sampled, done := make(chan bool), make(chan bool)
+			go func() {
+				var m runtime.MemStats
+				for {
+					select {
+					case <-done:
+						sampled <- true
+						return
+					case <-time.After(20 * time.Millisecond):
+						runtime.GC()
+						runtime.ReadMemStats(&m)
+						if m.HeapAlloc > peak {
+							peak = m.HeapAlloc
+						}
+					}
+				}
+			}()
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				NewIndex().Start(opt)
+			}
+			b.StopTimer()
+			done <- true
+			<-sampled
+			b.ReportMetric(float64(peak), "peak-live-B")
+		})
+	}
+}
@@ -1,27 +1,36 @@
 package backyard
 
 import (
-	"bytes"
-	"io/ioutil"
-	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
-	"github.com/barasher/go-exiftool"
-	"github.com/njhsi/8ackyard/internal/config"
 	"github.com/njhsi/8ackyard/internal/meta"
-	"github.com/photoprism/photoprism/pkg/fs"
 )
 
 type IndexOptions struct {
-	Path       string
-	BackupPath string
-	CachePath  string
-	Hostname   string
-	NumWorkers int
-	Rescan     bool
-	Convert    bool
-	Stack      bool
+	Path            string
+	Files           []string // only these files under Path, backing up only them, instead of walking it all
+	BackupPath      string
+	CachePath       string
+	Hostname        string
+	TimeZones       *TimeZones
+	SizeLimit       int64 // of originals, no limit if 0
+	Layout          *Layout
+	Sidecars        Sidecars // extensions of sidecar files
+	Documents       bool     // back up non-media files by DocumentsLayout
+	DocumentsLayout *Layout
+	AltNames        LinkMode // link alternate names of backups
+	NumWorkers      int
+	Force           bool      // re-index unchanged files too
+	Takeout         bool      // pair media with json of Google Takeout, for time taken and albums
+	Cleanup         bool      // remove index entries of files gone
+	CleanupFiles    []string  // only these files, or dirs, are cleaned up if not nil, instead of all under Path
+	Cleaned         *[]string // if not nil, set to the names of entries removed by Cleanup
+	Rescan          bool
+	Convert         bool
+	Stack           bool
+	Plan            *Plan // dry run if not nil: index into a copy of the db, and plan the backup into it
 }
 
 type IndexJob struct {
@@ -31,86 +40,80 @@ type IndexJob struct {
 	ChDB     chan *File8
 }
 
-func IndexWorker(jobs <-chan IndexJob, et *exiftool.Exiftool) {
+func IndexWorker(jobs <-chan IndexJob, extractor MetadataExtractor) {
 	for job := range jobs {
 		log.Infof("IndexWorker:                           fileName=%s", job.FileName)
-		mainIndex(job.FileName, job.Ind, job.IndexOpt, et, job.ChDB)
+		mainIndex(job.FileName, job.Ind, job.IndexOpt, extractor, job.ChDB)
 
 	}
 }
 
-func mainIndex(fileName string, ind *Index, opt IndexOptions, exifTool *exiftool.Exiftool, chDB chan *File8) {
-	//	log.Infof("mainIndex: entering, %v , %v", fileName, exifTool)
-
-	sizeLimit := config.OriginalsLimit()
-
-	err, fi := NewFileIndex(fileName)
-	if err != nil || fi == nil || fi.Size <= 0 || fi.Size > sizeLimit {
+func mainIndex(fileName string, ind *Index, opt IndexOptions, extractor MetadataExtractor, chDB chan *File8) {
+	err, fi := newFileIndex(fileName, opt.TimeZones.Location(fileName, ""), opt.Plan == nil || !opt.Plan.NoHash)
+	if err != nil || fi == nil || fi.Size <= 0 || (opt.SizeLimit > 0 && fi.Size > opt.SizeLimit) {
 		log.Errorf("mainIndex: NewFileIndex - wrong of file size of %v,  err=%v, fi=%v", fileName, err, fi)
 		return
 	}
 	if len(opt.Hostname) > 0 {
 		fi.Hostname = opt.Hostname
 	}
+	if opt.Sidecars.Is(fileName) { // follows its primary media file, no metadata of its own
+		fi.MIMEType, fi.MIMESubtype = MIMETypeSidecar, strings.ToLower(strings.TrimPrefix(filepath.Ext(fileName), "."))
+		chDB <- fi
+		log.Infof("mainIndex:  DONE(%v) - sidecar fi=%+v", fileName, fi)
+		return
+	}
 
 	exif := &meta.Data{}
-	idStr := Int64ToString(fi.Id)
-	exifJson, err := CacheName(idStr, "json", "exiftool.json")
-	if err != nil {
-		log.Fatalf("mainIndex: CacheName - %v %v", fileName, err)
+	if err := extractor.Extract(fileName, fi, exif); err != nil {
+		log.Infof("mainIndex: no metadata of %v - %v", fileName, err)
 	}
-	if fs.FileExists(exifJson) {
-		log.Infof("mainIndex: json %v existed ..", exifJson)
-		jsonFile, err := os.Open(exifJson)
-		if err != nil {
-			log.Fatalf("mainIndex: Open - %v %v", fileName, err)
-		}
-		defer jsonFile.Close()
-		var jbuf bytes.Buffer
-		jbuf.ReadFrom(jsonFile)
-		if err = exif.Exiftool(jbuf.Bytes(), ""); err != nil { //TODO: exif.JSON(exifJson,"")
-			log.Errorf("mainIndex: exif.DataFromExiftool %v %v", exifJson, err)
-		}
-	} else {
-		if jbuf, err := buildExifJson(fileName, exifTool); err == nil {
-			if err := exif.Exiftool(jbuf, ""); err != nil {
-				log.Errorf("mainIndex: DataFromExiftool %v - err=%v, exif=%v", fileName, err, exif)
-			}
-			if exif.TakenAt.Year() > 1900 {
-				ioutil.WriteFile(exifJson, jbuf, 0644)
+	takeout := false
+	if opt.Takeout {
+		if !hasBirth(exif) {
+			if err := (TakeoutExtractor{}).Extract(fileName, fi, exif); err != nil {
+				log.Infof("mainIndex: no takeout metadata of %v - %v", fileName, err)
 			}
+			takeout = hasBirth(exif)
 		}
+		fi.albums_ = takeoutAlbums(fileName)
 	}
 
+	fi.meta_ = newMediaMeta(fi.Id, exif)
+	fi.search_ = newSearchDoc(fi.Id, exif)
+
 	if len(fi.MIMEType) == 0 && len(exif.MIMEType) > 0 {
 		mts := strings.Split(exif.MIMEType, "/")
 		fi.MIMEType, fi.MIMESubtype = mts[0], mts[1]
 	}
+	timeLoc := opt.TimeZones.Location(fileName, exif.CameraModel)
 	if exif.TakenAt.Year() > 1900 {
 		takeAt := exif.TakenAt
 		if len(exif.TimeZone) == 0 {
-			timeLoc, _ := time.LoadLocation("Asia/Chongqing")
 			if len(exif.OffsetTimeOriginal) > 0 {
-				layouts := [4]string{"+08:00", "+0800", "-08:00", "-0800"}
-				for _, layout := range layouts {
-					if tos, err := time.Parse(layout, exif.OffsetTimeOriginal); err == nil {
-						timeLoc = tos.Location()
-						log.Infof("mainIndex: lookup timezone by layout=%v, got loc=%v", layout, timeLoc)
-						break
-					}
+				if loc, err := zoneLocation(exif.OffsetTimeOriginal); err == nil {
+					timeLoc = loc
+					log.Infof("mainIndex: lookup timezone by offset=%v, got loc=%v", exif.OffsetTimeOriginal, timeLoc)
 				}
-
 			}
-			tDuration := time.Date(takeAt.Year(), takeAt.Month(), takeAt.Day(), 0, 0, 0, 0, timeLoc).Sub(time.Date(takeAt.Year(), takeAt.Month(), takeAt.Day(), 0, 0, 0, 0, takeAt.Location()))
-			takeAt = takeAt.Add(tDuration)
-			takeAt = takeAt.In(timeLoc)
-			log.Infof("mainIndex: exif has no TimeZone, did adjust.  exif.takenat=%v,  duration=%v", exif.TakenAt, tDuration)
+			takeAt = inZone(takeAt, timeLoc)
+			log.Infof("mainIndex: exif has no TimeZone, did adjust.  exif.takenat=%v, takeat=%v", exif.TakenAt, takeAt)
+		} else if exif.TimeZone != time.UTC.String() { // utc only tells the time, not where
+			if loc, err := zoneLocation(exif.TimeZone); err == nil {
+				timeLoc = loc
+			}
+		}
+		fi.TimeBorn, fi.TimeBornSrc = takeAt.Unix(), TimeBornSrcMeta
+		if takeout {
+			fi.TimeBornSrc = TimeBornSrcTakeout
 		}
-		fi.TimeBorn, fi.TimeBornSrc = takeAt.Unix(), TimeBornSrcMeta //TODO: exif.TimeZone
+	} else if fi.TimeBornSrc == TimeBornSrcName && timeLoc.String() != fi.TimeZone { // camera has its own zone
+		fi.TimeBorn = guestTimeBorn(fileName, timeLoc).Unix()
 	}
+	fi.TimeZone = timeLoc.String()
 
 	chDB <- fi
 	log.Infof("mainIndex:  DONE(%v) - fi.timebor=%v|exif(takenat=%v,tz=%v,timeoffset=%v)|fi=%+v,err=%v",
-		fileName, time.Unix(fi.TimeBorn, 0).Local(),
+		fileName, time.Unix(fi.TimeBorn, 0).In(timeLoc),
 		exif.TakenAt, exif.TimeZone, exif.OffsetTimeOriginal, fi, err)
 }
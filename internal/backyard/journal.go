@@ -0,0 +1,157 @@
+package backyard
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"time"
+
+	"github.com/karrick/godirwalk"
+)
+
+// JournalState is how far the backup job of a content id went in the run going on.
+type JournalState string
+
+const (
+	JournalPlanned JournalState = "planned"
+	JournalRunning JournalState = "running" // sent to a worker, maybe copying
+	JournalDone    JournalState = "done"    // recorded in filez
+)
+
+// backupTmpRegexp matches temporary copies into the backup, dest-<id>.tmp of BackupWorker.
+var backupTmpRegexp = regexp.MustCompile(`-[0-9a-f]{16}\.tmp$`)
+
+// journalDone returns ids done by an interrupted backup run, and if there was one left in the journal.
+func journalDone(db *sql.DB) (done map[int64]bool, interrupted bool) {
+	done = make(map[int64]bool)
+	dbrows, err := db.Query("select id, state from backup_journal")
+	if err != nil {
+		log.Errorf("backup journal: Query %v", err)
+		return done, false
+	}
+	defer dbrows.Close()
+	for dbrows.Next() {
+		var id int64
+		var state JournalState
+		if err := dbrows.Scan(&id, &state); err != nil {
+			continue
+		}
+		interrupted = true
+		if state == JournalDone {
+			done[id] = true
+		}
+	}
+	return done, interrupted
+}
+
+// journalPlan adds ids to the journal as planned, keeping the state of those there already.
+func journalPlan(db *sql.DB, ids []int64) error {
+	dbtx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	stmt, err := dbtx.Prepare("insert or ignore into backup_journal(id, state, timeupdated) values(?, ?, ?)")
+	if err != nil {
+		dbtx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+	now := time.Now().Unix()
+	for _, id := range ids {
+		if _, err := stmt.Exec(id, JournalPlanned, now); err != nil {
+			dbtx.Rollback()
+			return err
+		}
+	}
+	return dbtx.Commit()
+}
+
+// journalMark sets the state of id, in dbtx so that done is committed along with filez.
+func journalMark(dbtx *sql.Tx, id int64, state JournalState) error {
+	_, err := dbtx.Exec("update backup_journal set state=?, timeupdated=? where id=?", state, time.Now().Unix(), id)
+	return err
+}
+
+// journalClear forgets the jobs of ids once their run completes, or all of them if ids is nil, after a full run.
+func journalClear(db *sql.DB, ids []int64) error {
+	if ids == nil {
+		_, err := db.Exec("delete from backup_journal")
+		return err
+	}
+	dbtx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if _, err := dbtx.Exec("delete from backup_journal where id=?", id); err != nil {
+			dbtx.Rollback()
+			return err
+		}
+	}
+	return dbtx.Commit()
+}
+
+// journalPrune forgets jobs of ids gone from the files of hostname since planned, like by cleanup or dedupe.
+func journalPrune(db *sql.DB, hostname string) error {
+	_, err := db.Exec("delete from backup_journal where id not in (select id from files where hostname=?)", hostname)
+	return err
+}
+
+// removeBackupTmps removes temporary copies under backupPath, left by an interrupted run.
+// it must be called with the backup locked, when no copy is going on.
+func removeBackupTmps(backupPath string) (removed []string) {
+	godirwalk.Walk(backupPath, &godirwalk.Options{
+		ErrorCallback: func(fileName string, err error) godirwalk.ErrorAction {
+			return godirwalk.SkipNode
+		},
+		Callback: func(fileName string, info *godirwalk.Dirent) error {
+			if info.IsRegular() && backupTmpRegexp.MatchString(filepath.Base(fileName)) {
+				if err := os.Remove(fileName); err != nil {
+					log.Warnf("backup journal: remove %v err=%v", fileName, err)
+				} else {
+					removed = append(removed, fileName)
+				}
+			}
+			return nil
+		},
+		Unsorted: true,
+	})
+	return removed
+}
+
+// exceptIds returns ids not in except.
+func exceptIds(ids []int64, except map[int64]bool) []int64 {
+	if len(except) == 0 {
+		return ids
+	}
+	kept := make([]int64, 0, len(ids))
+	for _, id := range ids {
+		if !except[id] {
+			kept = append(kept, id)
+		}
+	}
+	return kept
+}
+
+// syncFile flushes name to disk.
+func syncFile(name string) error {
+	f, err := os.Open(name) // read-only, the copy may be so by its mode
+	if err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// syncDir flushes the entries of dir to disk, like a file renamed into it. not on windows, which can not.
+func syncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	return syncFile(dir)
+}
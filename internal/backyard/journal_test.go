@@ -0,0 +1,124 @@
+package backyard
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/njhsi/8ackyard/internal/mutex"
+)
+
+func TestBackupJournal(t *testing.T) {
+	dir, backupPath := t.TempDir(), t.TempDir()
+	cachePath, names := createTestDupes(t, dir, false)
+	other := filepath.Join(dir, "IMG_0002.jpg")
+	os.WriteFile(other, []byte("other content"), 0644)
+	otherId, otherSum, _ := fileHashes(other)
+	id, _, _ := fileHashes(names[0])
+
+	mtime := func(name string) int64 {
+		_, t, _ := fileStat(name)
+		return t.Unix()
+	}
+
+	db, err := OpenDb(cachePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.Exec("update files set timemodified=?, timeborn=1560333010, timebornsrc='meta', mimetype='image', mimesubtype='', info='', timezone='UTC'", mtime(names[0]))
+	db.Exec(`insert into files(name, hostname, id, size, timemodified, timeborn, timebornsrc, mimetype, mimesubtype, info, timezone, sha256)
+                 values(?, 'h', ?, 13, ?, 1560333010, 'meta', 'image', '', '', 'UTC', ?)`, other, otherId, mtime(other), otherSum)
+	opt := IndexOptions{Path: dir, BackupPath: backupPath, CachePath: cachePath, Hostname: "h"}
+
+	countFilez := func() (n int) {
+		db.QueryRow("select count(*) from filez").Scan(&n)
+		return n
+	}
+
+	// canceled before any job
+	mutex.MainWorker.Start()
+	mutex.MainWorker.Cancel()
+	backup_start(opt, db)
+	mutex.MainWorker.Stop()
+	assert.Equal(t, 0, countFilez())
+	_, interrupted := journalDone(db)
+	assert.True(t, interrupted, "kept to resume")
+
+	// interrupted after the first was done, while copying the other
+	orphan := filepath.Join(backupPath, "IMG_0002.jpg-"+Int64ToString(otherId)+".tmp")
+	os.WriteFile(orphan, []byte("other"), 0644)
+	journalPlan(db, []int64{id, otherId})
+	dbtx, _ := db.Begin()
+	journalMark(dbtx, id, JournalDone)
+	journalMark(dbtx, otherId, JournalRunning)
+	dbtx.Commit()
+
+	done, interrupted := journalDone(db)
+	assert.True(t, interrupted)
+	assert.Equal(t, map[int64]bool{id: true}, done)
+
+	backup_start(opt, db)
+	_, err = os.Stat(orphan)
+	assert.True(t, os.IsNotExist(err), "orphan copy removed")
+	assert.Equal(t, 1, countFilez(), "done one skipped")
+	var name string
+	db.QueryRow("select name from filez where id=?", otherId).Scan(&name)
+	data, _ := os.ReadFile(name)
+	assert.Equal(t, "other content", string(data))
+
+	_, interrupted = journalDone(db)
+	assert.False(t, interrupted, "cleared once complete")
+
+	// left by an interrupted run, of a file gone since
+	journalPlan(db, []int64{42})
+	opt.Files = []string{other}
+	backup_start(opt, db)
+	_, interrupted = journalDone(db)
+	assert.False(t, interrupted, "pruned")
+
+	opt.Files = nil
+	backup_start(opt, db)
+	assert.Equal(t, 2, countFilez())
+}
+
+func TestBackupJournalAccept(t *testing.T) {
+	dir, backupPath := t.TempDir(), t.TempDir()
+	cachePath, names := createTestDupes(t, dir, false)
+	id, _, _ := fileHashes(names[0])
+
+	db, err := OpenDb(cachePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for i, name := range names { // born apart by metadata, quarantined
+		_, mtime, _ := fileStat(name)
+		db.Exec(`update files set timemodified=?, timeborn=?, timebornsrc='meta', mimetype='image', mimesubtype='', info='', timezone='UTC'
+                         where name=?`, mtime.Unix(), 1560333010+i, name)
+	}
+	opt := IndexOptions{Path: dir, BackupPath: backupPath, CachePath: cachePath, Hostname: "h"}
+	backupOpt := BackupOptions{BackupPath: backupPath, CachePath: cachePath}
+	backupOpt.Layout, _ = NewLayout(DefaultLayout)
+
+	// quarantined by a run, interrupted afterwards
+	journalPlan(db, []int64{id})
+	assert.True(t, backupFiles(opt, backupOpt, db, []int64{id}))
+	done, interrupted := journalDone(db)
+	assert.True(t, interrupted)
+	assert.Empty(t, done, "quarantined is not done")
+
+	n, err := ResolveConflicts(cachePath, id, ConflictAccepted)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+
+	backup_start(opt, db) // resumes
+	var name string
+	db.QueryRow("select name from filez where id=?", id).Scan(&name)
+	data, _ := os.ReadFile(name)
+	assert.Equal(t, "same content", string(data), "backed up once accepted")
+	_, interrupted = journalDone(db)
+	assert.False(t, interrupted, "cleared once complete")
+}
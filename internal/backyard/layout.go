@@ -0,0 +1,167 @@
+package backyard
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/njhsi/8ackyard/internal/meta"
+)
+
+// DefaultLayout backups into mime type and birth date, like image/2006/01/02/IMG_0001.JPG
+const DefaultLayout = "{{.MIMEType}}/{{.Year}}/{{.Month}}/{{.Day}}/{{.Basename}}"
+
+// DefaultDocumentsLayout backups non-media files into year of birth, like documents/2006/notes.txt
+const DefaultDocumentsLayout = "documents/{{.Year}}/{{.Basename}}"
+
+// Layout builds backup destinations from a text/template, like
+//
+//	{{.MIMEType}}/{{.Year}}/{{.Month}}-{{.CameraModel}}/{{.Basename}}
+type Layout struct {
+	text string
+	tmpl *template.Template
+}
+
+// LayoutData is what a layout template can use, with File8 fields like .MIMEType, .MIMESubtype, .Hostname.
+type LayoutData struct {
+	File8
+	Basename    string // preferred name of the file
+	Stem        string // basename without extension
+	Ext         string // extension without dot
+	IdHex       string // xxh3 in hex
+	Year        string // of birth, in its time zone
+	Month       string // 01-12
+	Day         string // 01-31
+	CameraMake  string
+	CameraModel string
+	LensModel   string
+	Zone        string // time zone of the gps position, like Europe/Berlin
+	Country     string // ISO 3166 country code of Zone, like DE
+	Meta        *meta.Data
+}
+
+var layoutFuncs = template.FuncMap{
+	"clean": layoutClean,
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+}
+
+// NewLayout parses the layout template text, DefaultLayout if empty.
+func NewLayout(text string) (*Layout, error) {
+	if text == "" {
+		text = DefaultLayout
+	}
+
+	tmpl, err := template.New("layout").Funcs(layoutFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("layout: %v", err)
+	}
+
+	l := &Layout{text: text, tmpl: tmpl}
+	if _, err := l.Dest("/", NewLayoutData(&File8{MIMEType: "image"}, "IMG_0001.JPG", nil)); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+func (l *Layout) String() string {
+	return l.text
+}
+
+// NewLayoutData returns layout data of the file to back up as basename, with metadata if known.
+func NewLayoutData(f *File8, basename string, data *meta.Data) *LayoutData {
+	birth := time.Unix(f.TimeBorn, 0).In(ZoneLocation(f.TimeZone))
+	ext := filepath.Ext(basename)
+
+	d := &LayoutData{
+		File8:    *f,
+		Basename: basename,
+		Stem:     strings.TrimSuffix(basename, ext),
+		Ext:      strings.TrimPrefix(ext, "."),
+		IdHex:    Int64ToString(f.Id),
+		Year:     birth.Format("2006"),
+		Month:    birth.Format("01"),
+		Day:      birth.Format("02"),
+		Meta:     data,
+	}
+	if d.Meta == nil {
+		d.Meta = &meta.Data{}
+	}
+
+	d.CameraMake = layoutClean(d.Meta.CameraMake)
+	d.CameraModel = layoutClean(d.Meta.CameraModel)
+	d.LensModel = layoutClean(d.Meta.LensModel)
+	if d.Meta.TimeZone != time.UTC.String() {
+		d.Zone = d.Meta.TimeZone
+		d.Country = zoneCountry(d.Zone)
+	}
+
+	return d
+}
+
+// Dest returns the destination in backupPath for the layout data.
+func (l *Layout) Dest(backupPath string, d *LayoutData) (string, error) {
+	var buf bytes.Buffer
+	if err := l.tmpl.Execute(&buf, d); err != nil {
+		return "", fmt.Errorf("layout: %v", err)
+	}
+
+	rel := path.Clean("/" + buf.String())
+	if rel == "/" || strings.HasSuffix(buf.String(), "/") {
+		return "", fmt.Errorf("layout: %q gives no file name for %v", l.text, d.Basename)
+	}
+
+	return path.Clean(backupPath + rel), nil
+}
+
+// layoutClean makes s usable as a single path element.
+func layoutClean(s string) string {
+	s = strings.TrimSpace(s)
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '\\', ':', '*', '?', '"', '<', '>', '|', 0:
+			return '_'
+		}
+		return r
+	}, s)
+}
+
+var zoneCountries map[string]string
+var onceZoneCountries sync.Once
+
+// zoneCountry returns the country code of an IANA time zone, as in zone.tab of the system.
+func zoneCountry(zone string) string {
+	if zone == "" {
+		return ""
+	}
+
+	onceZoneCountries.Do(func() {
+		zoneCountries = make(map[string]string)
+
+		file, err := os.Open("/usr/share/zoneinfo/zone.tab")
+		if err != nil {
+			log.Warnf("layout: no country of time zones - %v", err)
+			return
+		}
+		defer file.Close()
+
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			fields := strings.Split(scanner.Text(), "\t")
+			if len(fields) < 3 || strings.HasPrefix(fields[0], "#") {
+				continue
+			}
+			zoneCountries[fields[2]] = fields[0]
+		}
+	})
+
+	return zoneCountries[zone]
+}
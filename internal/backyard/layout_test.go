@@ -0,0 +1,107 @@
+package backyard
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/njhsi/8ackyard/internal/meta"
+)
+
+func TestLayout(t *testing.T) {
+	born := time.Date(2019, 6, 30, 23, 30, 0, 0, ZoneLocation("Europe/Berlin"))
+	f := &File8{Id: 1, Name: "/originals/IMG_0001.JPG", MIMEType: "image", MIMESubtype: "jpeg",
+		TimeBorn: born.Unix(), TimeZone: "Europe/Berlin"}
+
+	t.Run("default", func(t *testing.T) {
+		l, err := NewLayout("")
+		if err != nil {
+			t.Fatal(err)
+		}
+		dest, err := l.Dest("/mnt/backup", NewLayoutData(f, "IMG_0001.JPG", nil))
+		assert.NoError(t, err)
+		assert.Equal(t, "/mnt/backup/image/2019/06/30/IMG_0001.JPG", dest)
+	})
+
+	t.Run("meta", func(t *testing.T) {
+		l, err := NewLayout("{{.MIMEType}}/{{.Year}}/{{.Month}}-{{.CameraModel}}/{{.Country}}/{{lower .Ext}}/{{.Basename}}")
+		if err != nil {
+			t.Fatal(err)
+		}
+		data := &meta.Data{CameraModel: "X-T3 / II", TimeZone: "Europe/Berlin"}
+		dest, err := l.Dest("/mnt/backup", NewLayoutData(f, "IMG_0001.JPG", data))
+		assert.NoError(t, err)
+		assert.Equal(t, "/mnt/backup/image/2019/06-X-T3 _ II/DE/jpg/IMG_0001.JPG", dest)
+	})
+
+	t.Run("no escape", func(t *testing.T) {
+		l, err := NewLayout("../../{{.Basename}}")
+		if err != nil {
+			t.Fatal(err)
+		}
+		dest, err := l.Dest("/mnt/backup", NewLayoutData(f, "IMG_0001.JPG", nil))
+		assert.NoError(t, err)
+		assert.Equal(t, "/mnt/backup/IMG_0001.JPG", dest)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := NewLayout("{{.Camera}}/{{.Basename}}")
+		assert.Error(t, err)
+		_, err = NewLayout("{{.Year}}/")
+		assert.Error(t, err)
+		_, err = NewLayout("{{.Year")
+		assert.Error(t, err)
+	})
+}
+
+func TestRelayout(t *testing.T) {
+	backupPath := t.TempDir()
+	cachePath := t.TempDir()
+
+	born := time.Date(2019, 6, 30, 12, 0, 0, 0, time.UTC)
+	oldName := filepath.Join(backupPath, "image/2019/06/30/IMG_0001.JPG")
+	if err := os.MkdirAll(filepath.Dir(oldName), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(oldName, []byte("jpeg"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := CreateDb(cachePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`insert into filez(id, name, hostname, size, timemodified, timeborn, timebornsrc, mimetype, mimesubtype, info, timezone)
+                          values(1, ?, 'h', 4, 0, ?, 'meta', 'image', 'jpeg', '', 'UTC')`, oldName, born.Unix())
+	assert.NoError(t, err)
+	db.Close()
+
+	layout, err := NewLayout("{{.MIMEType}}/{{.Year}}/{{.Month}}/{{.Basename}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	moved, err := Relayout(RelayoutOptions{BackupPath: backupPath, CachePath: cachePath, Layout: layout})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, moved)
+
+	newName := filepath.Join(backupPath, "image/2019/06/IMG_0001.JPG")
+	assert.FileExists(t, newName)
+	assert.NoDirExists(t, filepath.Dir(oldName))
+
+	db, err = OpenDb(cachePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var name string
+	assert.NoError(t, db.QueryRow("select name from filez where id=1").Scan(&name))
+	assert.Equal(t, newName, name)
+
+	moved, err = Relayout(RelayoutOptions{BackupPath: backupPath, CachePath: cachePath, Layout: layout})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, moved)
+}
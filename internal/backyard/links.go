@@ -0,0 +1,256 @@
+package backyard
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	iofs "io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/njhsi/8ackyard/internal/meta"
+)
+
+type LinkMode string
+
+const (
+	LinkNone     LinkMode = ""         // alternate names are not linked
+	LinkSymlink  LinkMode = "symlink"  // relative symlinks to the backup file
+	LinkHardlink LinkMode = "hardlink" // hardlinks of the backup file, same filesystem only
+)
+
+// ParseLinkMode parses none, symlink or hardlink, none if empty.
+func ParseLinkMode(s string) (LinkMode, error) {
+	switch s {
+	case "", "none":
+		return LinkNone, nil
+	case string(LinkSymlink), string(LinkHardlink):
+		return LinkMode(s), nil
+	}
+	return LinkNone, fmt.Errorf("links: unknown mode %q, none, symlink or hardlink expected", s)
+}
+
+// altNames returns where the layout puts each of files by its own name and birth, other than those in skip,
+// fb being the backup file they are the sources of.
+func altNames(layout *Layout, backupPath string, fb *File8, files []*File8, data *meta.Data, skip ...string) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, name := range skip {
+		seen[name] = true
+	}
+	for _, f := range files {
+		alt := *fb
+		alt.TimeBorn, alt.TimeZone = f.TimeBorn, f.TimeZone
+		name, err := layout.Dest(backupPath, NewLayoutData(&alt, filepath.Base(f.Name), data))
+		if err != nil || seen[name] {
+			continue
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	return names
+}
+
+// isLinkOf returns true if name is a link of kind to target.
+func isLinkOf(kind LinkMode, name, target string) bool {
+	switch kind {
+	case LinkSymlink:
+		to, err := os.Readlink(name)
+		if err != nil {
+			return false
+		}
+		if !filepath.IsAbs(to) {
+			to = filepath.Join(filepath.Dir(name), to)
+		}
+		return filepath.Clean(to) == filepath.Clean(target)
+	case LinkHardlink:
+		fi, err := os.Lstat(name)
+		if err != nil || fi.Mode()&os.ModeSymlink != 0 {
+			return false
+		}
+		ti, err := os.Stat(target)
+		return err == nil && os.SameFile(fi, ti)
+	}
+	return false
+}
+
+// makeLink creates name as a link of kind to target, never overwriting anything.
+func makeLink(kind LinkMode, target, name string) error {
+	if _, err := os.Lstat(name); err == nil {
+		return fmt.Errorf("links: %v exists", name)
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+	switch kind {
+	case LinkSymlink:
+		rel, err := filepath.Rel(filepath.Dir(name), target)
+		if err != nil {
+			return err
+		}
+		return os.Symlink(rel, name)
+	case LinkHardlink:
+		return os.Link(target, name)
+	}
+	return fmt.Errorf("links: unknown mode %q", kind)
+}
+
+// removeLink removes name if it is still a link of kind, to target if a hardlink, which can not be told apart otherwise.
+func removeLink(kind LinkMode, name, target string) error {
+	fi, err := os.Lstat(name)
+	if errors.Is(err, iofs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	switch {
+	case kind == LinkSymlink && fi.Mode()&os.ModeSymlink != 0:
+	case kind == LinkHardlink && isLinkOf(kind, name, target):
+	default:
+		return fmt.Errorf("links: %v is not a %v of %v anymore, kept", name, kind, target)
+	}
+	return os.Remove(name)
+}
+
+// linkAltNames links the alternate names of the job files to the backup file dest, which the layout meant to be
+// layoutDest, replacing links of the id made before, and removes those of them not wanted anymore.
+// it returns the links in place, nil if none were handled.
+func linkAltNames(job *BackupJob, layout *Layout, fb *File8, data *meta.Data, dest, layoutDest string) map[string]LinkMode {
+	mode := job.BackupOpt.AltNames
+	if mode == LinkNone && len(job.Links) == 0 {
+		return nil
+	}
+
+	links := make(map[string]LinkMode)
+	if mode != LinkNone {
+		for _, name := range altNames(layout, job.BackupOpt.BackupPath, fb, job.Files, data, dest, layoutDest) {
+			job.Bfm.Lock(name)
+			if old, ok := job.Links[name]; ok {
+				if old == mode && isLinkOf(mode, name, dest) {
+					links[name] = mode
+					job.Bfm.UnLock(name)
+					continue
+				}
+				if err := removeLink(old, name, dest); err != nil {
+					log.Warnf("BackupWorker: %v", err)
+				}
+			}
+			if err := makeLink(mode, dest, name); err != nil {
+				log.Warnf("BackupWorker: no %v of %v as %v - %v", mode, dest, name, err)
+			} else {
+				log.Infof("BackupWorker: linked %v -> %v", name, dest)
+				links[name] = mode
+			}
+			job.Bfm.UnLock(name)
+		}
+	}
+
+	for name, kind := range job.Links {
+		if _, ok := links[name]; ok {
+			continue
+		}
+		job.Bfm.Lock(name)
+		if err := removeLink(kind, name, dest); err != nil {
+			log.Warnf("BackupWorker: %v", err)
+		}
+		job.Bfm.UnLock(name)
+	}
+
+	return links
+}
+
+// loadLinks returns links of id in the backup path, by name.
+func loadLinks(dbtx *sql.Tx, id int64) map[string]LinkMode {
+	rows, err := dbtx.Query("select name, kind from links where id=?", id)
+	if err != nil {
+		log.Warnf("links: Query %v", err)
+		return nil
+	}
+	defer rows.Close()
+
+	var links map[string]LinkMode
+	for rows.Next() {
+		var name string
+		var kind LinkMode
+		if err := rows.Scan(&name, &kind); err != nil {
+			continue
+		}
+		if links == nil {
+			links = make(map[string]LinkMode)
+		}
+		links[name] = kind
+	}
+	return links
+}
+
+// saveLinks replaces links of id in db by links.
+func saveLinks(dbtx *sql.Tx, id int64, links map[string]LinkMode) error {
+	if _, err := dbtx.Exec("delete from links where id=?", id); err != nil {
+		return err
+	}
+	for name, kind := range links {
+		if _, err := dbtx.Exec("insert or replace into links(name, id, kind) values(?, ?, ?)", name, id, kind); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dropLinks removes links of ids, on disk and in db, target being where their backup file is by id.
+// they are made again by the next backup.
+func dropLinks(db *sql.DB, targets map[int64]string) error {
+	type link struct {
+		name string
+		id   int64
+		kind LinkMode
+	}
+	var links []link
+	rows, err := db.Query("select name, id, kind from links")
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var l link
+		if err := rows.Scan(&l.name, &l.id, &l.kind); err != nil {
+			rows.Close()
+			return err
+		}
+		if _, ok := targets[l.id]; ok {
+			links = append(links, l)
+		}
+	}
+	rows.Close()
+
+	dbtx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, l := range links {
+		if err := removeLink(l.kind, l.name, targets[l.id]); err != nil {
+			log.Warnf("%v", err)
+		}
+		if _, err := dbtx.Exec("delete from links where name=?", l.name); err != nil {
+			dbtx.Rollback()
+			return err
+		}
+	}
+	return dbtx.Commit()
+}
+
+// orphanLinks returns ids of links whose backup file is not in filez anymore, with no target.
+func orphanLinks(db *sql.DB) map[int64]string {
+	targets := make(map[int64]string)
+	rows, err := db.Query("select distinct id from links where id not in (select id from filez where name!='')")
+	if err != nil {
+		log.Warnf("links: Query %v", err)
+		return targets
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err == nil {
+			targets[id] = ""
+		}
+	}
+	return targets
+}
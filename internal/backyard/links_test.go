@@ -0,0 +1,110 @@
+package backyard
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLinkAltNames(t *testing.T) {
+	backupPath := t.TempDir()
+	layout, err := NewLayout("{{.Year}}/{{.Basename}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	born2019 := time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC).Unix()
+	born2018 := time.Date(2018, 6, 1, 0, 0, 0, 0, time.UTC).Unix()
+
+	dest := filepath.Join(backupPath, "2019", "IMG_1.jpg")
+	os.MkdirAll(filepath.Dir(dest), 0755)
+	os.WriteFile(dest, []byte("content"), 0644)
+	fb := &File8{Id: 1, Name: dest, Size: 7, MIMEType: "image", TimeBorn: born2019, TimeZone: "UTC"}
+	job := &BackupJob{
+		Id:        1,
+		BackupOpt: BackupOptions{BackupPath: backupPath, AltNames: LinkSymlink},
+		Files: []*File8{
+			{Id: 1, Name: "/a/IMG_1.jpg", TimeBorn: born2019, TimeZone: "UTC"},
+			{Id: 1, Name: "/b/IMG_0001 copy.jpg", TimeBorn: born2019, TimeZone: "UTC"},
+			{Id: 1, Name: "/c/IMG_1.jpg", TimeBorn: born2018, TimeZone: "UTC"},
+			{Id: 1, Name: "/d/taken.jpg", TimeBorn: born2019, TimeZone: "UTC"},
+		},
+		Bfm: NewBackupFsMutex(),
+	}
+	altName := filepath.Join(backupPath, "2019", "IMG_0001 copy.jpg")
+	altDate := filepath.Join(backupPath, "2018", "IMG_1.jpg")
+	taken := filepath.Join(backupPath, "2019", "taken.jpg")
+	os.WriteFile(taken, []byte("another file"), 0644)
+
+	t.Run("symlink", func(t *testing.T) {
+		links := linkAltNames(job, layout, fb, nil, dest, dest)
+		assert.Equal(t, map[string]LinkMode{altName: LinkSymlink, altDate: LinkSymlink}, links)
+		to, err := os.Readlink(altDate)
+		assert.NoError(t, err)
+		assert.Equal(t, "../2019/IMG_1.jpg", to)
+		assert.True(t, isLinkOf(LinkSymlink, altName, dest))
+
+		data, _ := os.ReadFile(taken)
+		assert.Equal(t, "another file", string(data), "never overwritten")
+		job.Links = links
+	})
+
+	t.Run("hardlink", func(t *testing.T) {
+		job.BackupOpt.AltNames = LinkHardlink
+		links := linkAltNames(job, layout, fb, nil, dest, dest)
+		assert.Equal(t, map[string]LinkMode{altName: LinkHardlink, altDate: LinkHardlink}, links)
+		assert.True(t, isLinkOf(LinkHardlink, altDate, dest))
+		assert.False(t, isLinkOf(LinkSymlink, altDate, dest))
+		job.Links = links
+	})
+
+	t.Run("none", func(t *testing.T) {
+		job.BackupOpt.AltNames = LinkNone
+		links := linkAltNames(job, layout, fb, nil, dest, dest)
+		assert.Empty(t, links)
+		assert.NotNil(t, links, "links of the id to delete")
+		for _, name := range []string{altName, altDate} {
+			_, err := os.Lstat(name)
+			assert.True(t, os.IsNotExist(err), name)
+		}
+		_, err := os.Stat(dest)
+		assert.NoError(t, err)
+
+		job.Links = nil
+		assert.Nil(t, linkAltNames(job, layout, fb, nil, dest, dest))
+	})
+}
+
+func TestVerifyLinks(t *testing.T) {
+	backupPath, cachePath := t.TempDir(), t.TempDir()
+	dest := filepath.Join(backupPath, "IMG_1.jpg")
+	os.WriteFile(dest, []byte("content"), 0644)
+	id, sum, _ := fileHashes(dest)
+	alt, gone := filepath.Join(backupPath, "alt", "IMG_2.jpg"), filepath.Join(backupPath, "IMG_3.jpg")
+	assert.NoError(t, makeLink(LinkSymlink, dest, alt))
+
+	db, err := CreateDb(cachePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`insert into filez(name, id, size, hostname, timemodified, timeborn, timebornsrc, mimetype, mimesubtype, info, sha256)
+                          values(?, ?, 7, 'h', 0, 0, 'meta', 'image', '', '', ?)`, dest, int64(id), sum)
+	assert.NoError(t, err)
+	dbtx, _ := db.Begin()
+	assert.NoError(t, saveLinks(dbtx, int64(id), map[string]LinkMode{alt: LinkSymlink, gone: LinkHardlink}))
+	assert.NoError(t, dbtx.Commit())
+	db.Close()
+
+	status := make(map[string]VerifyStatus)
+	summary, err := Verify(VerifyOptions{CachePath: cachePath}, func(r *VerifyReport) {
+		status[r.Name] = r.Status
+		if r.Link != "" {
+			assert.Equal(t, dest, r.LinkOf)
+		}
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]VerifyStatus{alt: VerifyOk, gone: VerifyLinkBroken, dest: VerifyMtime}, status)
+	assert.Equal(t, 0, summary.Damaged)
+}
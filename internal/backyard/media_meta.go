@@ -0,0 +1,79 @@
+package backyard
+
+import (
+	"database/sql"
+
+	"github.com/njhsi/8ackyard/internal/meta"
+)
+
+// MediaMeta is metadata of a file by content id, as extracted when indexing, in table media_meta.
+type MediaMeta struct {
+	Id          int64   `json:"id"`
+	CameraMake  string  `json:"camera_make,omitempty"`
+	CameraModel string  `json:"camera_model,omitempty"`
+	LensModel   string  `json:"lens_model,omitempty"`
+	Software    string  `json:"software,omitempty"`
+	Lat         float64 `json:"lat,omitempty"`
+	Lng         float64 `json:"lng,omitempty"`
+	Altitude    int     `json:"altitude,omitempty"`
+	Duration    float64 `json:"duration,omitempty"` // in seconds
+	FPS         float64 `json:"fps,omitempty"`
+	Codec       string  `json:"codec,omitempty"`
+	Width       int     `json:"width,omitempty"`
+	Height      int     `json:"height,omitempty"`
+	Title       string  `json:"title,omitempty"`
+	Description string  `json:"description,omitempty"`
+	Keywords    string  `json:"keywords,omitempty"` // comma separated
+	Artist      string  `json:"artist,omitempty"`
+}
+
+// newMediaMeta returns the metadata of id in data, or nil if data has none worth keeping.
+func newMediaMeta(id int64, data *meta.Data) *MediaMeta {
+	m := &MediaMeta{
+		Id:          id,
+		CameraMake:  data.CameraMake,
+		CameraModel: data.CameraModel,
+		LensModel:   data.LensModel,
+		Software:    data.Software,
+		Lat:         float64(data.Lat),
+		Lng:         float64(data.Lng),
+		Altitude:    data.Altitude,
+		Duration:    data.Duration.Seconds(),
+		FPS:         data.FPS,
+		Codec:       data.Codec,
+		Width:       data.Width,
+		Height:      data.Height,
+		Title:       data.Title,
+		Description: data.Description,
+		Keywords:    data.Keywords.String(),
+		Artist:      data.Artist,
+	}
+	if *m == (MediaMeta{Id: id}) {
+		return nil
+	}
+	return m
+}
+
+// saveMediaMeta adds or replaces the metadata of m.Id in db.
+func saveMediaMeta(dbtx *sql.Tx, m *MediaMeta) error {
+	_, err := dbtx.Exec(`insert or replace into media_meta(id, cameramake, cameramodel, lensmodel, software, lat, lng, altitude,
+                             duration, fps, codec, width, height, title, description, keywords, artist)
+                             values(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		m.Id, m.CameraMake, m.CameraModel, m.LensModel, m.Software, m.Lat, m.Lng, m.Altitude,
+		m.Duration, m.FPS, m.Codec, m.Width, m.Height, m.Title, m.Description, m.Keywords, m.Artist)
+	return err
+}
+
+// loadMediaMeta returns the metadata of id in db, or nil if none.
+func loadMediaMeta(db *sql.DB, id int64) (*MediaMeta, error) {
+	m := &MediaMeta{}
+	row := db.QueryRow(`select id, cameramake, cameramodel, lensmodel, software, lat, lng, altitude,
+                            duration, fps, codec, width, height, title, description, keywords, artist
+                            from media_meta where id=?`, id)
+	err := row.Scan(&m.Id, &m.CameraMake, &m.CameraModel, &m.LensModel, &m.Software, &m.Lat, &m.Lng, &m.Altitude,
+		&m.Duration, &m.FPS, &m.Codec, &m.Width, &m.Height, &m.Title, &m.Description, &m.Keywords, &m.Artist)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return m, err
+}
@@ -0,0 +1,45 @@
+package backyard
+
+import (
+	"testing"
+	"time"
+
+	"github.com/njhsi/8ackyard/internal/meta"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMediaMeta(t *testing.T) {
+	assert.Nil(t, newMediaMeta(1, &meta.Data{}))
+
+	db, err := CreateDb(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	data := &meta.Data{CameraModel: "X-T3", Duration: 11 * time.Minute, Width: 3840, Height: 2160,
+		Keywords: meta.Keywords{"hdr", "burst"}, Lat: 52.52, Lng: 13.405}
+	dbtx, _ := db.Begin()
+	assert.NoError(t, saveMediaMeta(dbtx, newMediaMeta(1, data)))
+	data.Title = "again"
+	assert.NoError(t, saveMediaMeta(dbtx, newMediaMeta(1, data))) // re-indexed
+	assert.NoError(t, dbtx.Commit())
+
+	m, err := loadMediaMeta(db, 1)
+	assert.NoError(t, err)
+	if assert.NotNil(t, m) {
+		assert.Equal(t, "X-T3", m.CameraModel)
+		assert.Equal(t, float64(660), m.Duration)
+		assert.Equal(t, "hdr, burst", m.Keywords)
+		assert.Equal(t, "again", m.Title)
+		assert.InDelta(t, 52.52, m.Lat, 0.0001)
+	}
+
+	var n int
+	db.QueryRow("select count(*) from media_meta where duration > 600 and cameramodel='X-T3'").Scan(&n)
+	assert.Equal(t, 1, n)
+
+	m, err = loadMediaMeta(db, 2)
+	assert.NoError(t, err)
+	assert.Nil(t, m)
+}
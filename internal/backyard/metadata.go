@@ -0,0 +1,213 @@
+package backyard
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/barasher/go-exiftool"
+	"github.com/njhsi/8ackyard/internal/meta"
+	"github.com/photoprism/photoprism/pkg/fs"
+)
+
+// MetadataExtractor reads metadata of the indexed file fi into data,
+// and returns an error if it has nothing to read.
+type MetadataExtractor interface {
+	Name() string
+	Extract(fileName string, fi *File8, data *meta.Data) error
+}
+
+// hasBirth tells if data has the time taken, so no more extractors are needed.
+func hasBirth(data *meta.Data) bool {
+	return data.TakenAt.Year() > 1900
+}
+
+// Extractors chains extractors by priority, the first one reading the time taken wins,
+// the rest only run when it is missing.
+type Extractors []MetadataExtractor
+
+func (ex Extractors) Name() string {
+	names := make([]string, len(ex))
+	for i, e := range ex {
+		names[i] = e.Name()
+	}
+	return strings.Join(names, ",")
+}
+
+func (ex Extractors) Extract(fileName string, fi *File8, data *meta.Data) error {
+	var errs []string
+	found := false
+	for _, e := range ex {
+		if err := e.Extract(fileName, fi, data); err != nil {
+			errs = append(errs, e.Name()+": "+err.Error())
+			continue
+		}
+		found = true
+		if hasBirth(data) {
+			return nil
+		}
+	}
+	if found {
+		return nil
+	}
+	return errors.New(strings.Join(errs, "; "))
+}
+
+// NewExtractors returns the default chain of extractors: exiftool, native and xmp sidecars.
+// et may be nil if exiftool is missing, its cached results are still read.
+func NewExtractors(et *exiftool.Exiftool, cachePath string, force bool) Extractors {
+	return Extractors{
+		&ExiftoolExtractor{Et: et, CachePath: cachePath, Force: force},
+		NativeExtractor{},
+		XMPExtractor{},
+	}
+}
+
+// dryRun returns ex with exif json cached in dryCachePath, not in the cache of the backup.
+func (ex Extractors) dryRun(dryCachePath string) Extractors {
+	for _, e := range ex {
+		if et, ok := e.(*ExiftoolExtractor); ok {
+			et.CachePath = dryCachePath
+		}
+	}
+	return ex
+}
+
+// ExiftoolExtractor reads metadata by a running exiftool process, cached as json in the cache dir.
+type ExiftoolExtractor struct {
+	Et        *exiftool.Exiftool
+	CachePath string
+	Force     bool // not read the cached json
+}
+
+func (e *ExiftoolExtractor) Name() string {
+	return "exiftool"
+}
+
+func (e *ExiftoolExtractor) Extract(fileName string, fi *File8, data *meta.Data) error {
+	exifJson, err := CacheName(e.CachePath, Int64ToString(fi.Id), "json", "exiftool.json")
+	if err != nil {
+		return err
+	}
+	if !e.Force && fs.FileExists(exifJson) {
+		log.Infof("ExiftoolExtractor: json %v existed ..", exifJson)
+		jbuf, err := os.ReadFile(exifJson)
+		if err != nil {
+			return err
+		}
+		return data.Exiftool(jbuf, "")
+	}
+
+	jbuf, err := buildExifJson(fileName, e.Et)
+	if err != nil {
+		return err
+	}
+	if err := data.Exiftool(jbuf, ""); err != nil {
+		return err
+	}
+	if hasBirth(data) {
+		ioutil.WriteFile(exifJson, jbuf, 0644)
+	}
+	return nil
+}
+
+// NativeExtractor reads metadata without exiftool:
+// exif of images by go-exif, and creation dates in mvhd/udta of mp4 and mov videos.
+type NativeExtractor struct{}
+
+func (NativeExtractor) Name() string {
+	return "native"
+}
+
+func (NativeExtractor) Extract(fileName string, fi *File8, data *meta.Data) error {
+	switch fi.MIMEType + "/" + fi.MIMESubtype {
+	case "image/jpeg":
+		return data.Exif(fileName, fs.ImageJPEG, false)
+	case "image/png":
+		return data.Exif(fileName, fs.ImagePNG, false)
+	case "image/heif", "image/heic":
+		return data.Exif(fileName, fs.ImageHEIC, false)
+	case "image/tiff":
+		return data.Exif(fileName, fs.ImageTIFF, false)
+	case "video/mp4", "video/quicktime", "video/x-m4v", "video/3gpp":
+		return data.MP4(fileName)
+	}
+
+	if fi.MIMEType == "image" { // raw formats are mostly tiff inside
+		return data.Exif(fileName, fs.Type(fi.MIMESubtype), true)
+	}
+
+	return fmt.Errorf("no native metadata support of %v/%v", fi.MIMEType, fi.MIMESubtype)
+}
+
+// XMPExtractor reads an xmp sidecar of the file, like IMG_0001.xmp or IMG_0001.JPG.xmp
+type XMPExtractor struct{}
+
+func (XMPExtractor) Name() string {
+	return "xmp"
+}
+
+func (XMPExtractor) Extract(fileName string, fi *File8, data *meta.Data) error {
+	xmpName := findSidecar(fileName, ".xmp")
+	if xmpName == "" {
+		return errors.New("no xmp sidecar")
+	}
+	return data.XMP(xmpName)
+}
+
+// TakeoutExtractor reads the json of Google Takeout paired with the file, like IMG_0001.JPG.json,
+// used by index --takeout when the file has no time taken of its own.
+type TakeoutExtractor struct{}
+
+func (TakeoutExtractor) Name() string {
+	return "takeout"
+}
+
+func (TakeoutExtractor) Extract(fileName string, fi *File8, data *meta.Data) error {
+	jsonName := findTakeoutJson(fileName)
+	if jsonName == "" {
+		return errors.New("no takeout json")
+	}
+	jbuf, err := os.ReadFile(jsonName)
+	if err != nil {
+		return err
+	}
+	p := meta.GPhoto{}
+	if err := json.Unmarshal(jbuf, &p); err != nil {
+		return fmt.Errorf("%v - %v", jsonName, err)
+	}
+	if !p.TakenAt.Exists() && !p.Geo.Exists() {
+		return fmt.Errorf("%v is not takeout json", jsonName)
+	}
+
+	hadBirth := hasBirth(data)
+	if err := data.GPhoto(jbuf); err != nil {
+		return err
+	}
+	if !hadBirth && p.TakenAt.Exists() { // a timestamp, not the wall clock GPhoto takes it for with geo
+		data.TakenAt, data.TakenAtLocal = p.TakenAt.Time(), p.TakenAt.Time()
+		if data.TimeZone == "" {
+			data.TimeZone = time.UTC.String()
+		} else if loc, err := time.LoadLocation(data.TimeZone); err == nil {
+			data.TakenAtLocal = data.TakenAt.In(loc)
+		}
+	}
+	return nil
+}
+
+// findSidecar returns the sidecar of fileName with extension ext in either case, named after the whole name
+// or its stem, or "" if none.
+func findSidecar(fileName, ext string) string {
+	for _, name := range []string{fileName, sidecarStem(fileName)} {
+		for _, e := range []string{strings.ToLower(ext), strings.ToUpper(ext)} {
+			if fs.FileExists(name + e) {
+				return name + e
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,80 @@
+package backyard
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/njhsi/8ackyard/internal/meta"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeExtractor sets the time taken, or fails without.
+type fakeExtractor struct {
+	name    string
+	takenAt time.Time
+	calls   int
+}
+
+func (e *fakeExtractor) Name() string {
+	return e.name
+}
+
+func (e *fakeExtractor) Extract(fileName string, fi *File8, data *meta.Data) error {
+	e.calls = e.calls + 1
+	if e.takenAt.IsZero() {
+		return errors.New("nothing")
+	}
+	data.TakenAt, data.TimeZone = e.takenAt, time.UTC.String()
+	return nil
+}
+
+func TestExtractors(t *testing.T) {
+	taken := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	t.Run("first with birth wins", func(t *testing.T) {
+		none, first, second := &fakeExtractor{name: "none"}, &fakeExtractor{name: "first", takenAt: taken}, &fakeExtractor{name: "second", takenAt: taken.Add(time.Hour)}
+		data := &meta.Data{}
+		assert.NoError(t, Extractors{none, first, second}.Extract("a.jpg", &File8{}, data))
+		assert.Equal(t, taken, data.TakenAt)
+		assert.Equal(t, []int{1, 1, 0}, []int{none.calls, first.calls, second.calls})
+	})
+
+	t.Run("all fail", func(t *testing.T) {
+		ex := Extractors{&fakeExtractor{name: "a"}, &fakeExtractor{name: "b"}}
+		err := ex.Extract("a.jpg", &File8{}, &meta.Data{})
+		assert.EqualError(t, err, "a: nothing; b: nothing")
+		assert.Equal(t, "a,b", ex.Name())
+	})
+}
+
+func TestFindSidecar(t *testing.T) {
+	dir := t.TempDir()
+	fileName := filepath.Join(dir, "IMG_0001.JPG")
+	assert.Equal(t, "", findSidecar(fileName, ".xmp"))
+
+	os.WriteFile(filepath.Join(dir, "IMG_0001.XMP"), []byte{}, 0644)
+	os.WriteFile(filepath.Join(dir, "IMG_0001.JPG.json"), []byte{}, 0644)
+	assert.Equal(t, filepath.Join(dir, "IMG_0001.XMP"), findSidecar(fileName, ".xmp"))
+	assert.Equal(t, filepath.Join(dir, "IMG_0001.JPG.json"), findSidecar(fileName, ".json"))
+}
+
+func TestMainIndexExtractor(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "IMG_0001.jpg")
+	if err := os.WriteFile(fileName, []byte("not really a jpeg"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	zones, _ := NewTimeZones("UTC")
+	opt := IndexOptions{CachePath: t.TempDir(), Hostname: "h", TimeZones: zones, Sidecars: NewSidecars(nil)}
+
+	taken := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	chDb := make(chan *File8, 1)
+	mainIndex(fileName, nil, opt, &fakeExtractor{name: "fake", takenAt: taken}, chDb)
+
+	fi := <-chDb
+	assert.Equal(t, taken.Unix(), fi.TimeBorn)
+	assert.Equal(t, TimeBornSrcMeta, fi.TimeBornSrc)
+	assert.Equal(t, "h", fi.Hostname)
+}
@@ -0,0 +1,132 @@
+package backyard
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/photoprism/photoprism/pkg/fs"
+)
+
+// PlanAction is what a backup run would do to a file, planned by a dry run.
+type PlanAction string
+
+const (
+	PlanCopy     PlanAction = "copy"     // new backup
+	PlanRename   PlanAction = "rename"   // existing backup moved to its dest
+	PlanSkip     PlanAction = "skip"     // not backed up, like non-media without --documents
+	PlanConflict PlanAction = "conflict" // quarantined
+)
+
+// PlanEntry is an action planned for a content id.
+type PlanEntry struct {
+	Action PlanAction `json:"action"`
+	Id     int64      `json:"id"`
+	Name   string     `json:"name"`           // original, or backup renamed
+	Dest   string     `json:"dest,omitempty"` // computed by BackupWorker, as in a real run
+	Size   int64      `json:"size"`
+	Reason string     `json:"reason,omitempty"`
+}
+
+// Plan collects what index and backup would do, without touching the backup path or the cache.
+// the db is a temporary copy, and so is exif json extracted meanwhile.
+type Plan struct {
+	Entries []PlanEntry `json:"entries"`
+	Kept    int         `json:"kept"` // backups in place already
+
+	// NoHash plans from stat only, not reading contents: new files are told apart by name, size and mtime,
+	// and backups of the same size are taken as of the same content.
+	NoHash bool `json:"no_hash"`
+
+	cachePath string           // temporary, of the db copy
+	dests     map[string]int64 // ids of dests planned, as if copied already
+	mutex     sync.Mutex
+}
+
+// NewPlan returns an empty plan, for IndexOptions.Plan of a dry run.
+func NewPlan() *Plan {
+	return &Plan{dests: make(map[string]int64)}
+}
+
+// Count returns the number of entries of action.
+func (p *Plan) Count(action PlanAction) (n int) {
+	for _, e := range p.Entries {
+		if e.Action == action {
+			n++
+		}
+	}
+	return n
+}
+
+// CopyBytes returns the total size of the copies planned.
+func (p *Plan) CopyBytes() (total int64) {
+	for _, e := range p.Entries {
+		if e.Action == PlanCopy {
+			total += e.Size
+		}
+	}
+	return total
+}
+
+// openDb copies the index db of cachePath to a temporary cache, and opens the copy.
+// the copy is by sqlite from a read-only connection, consistent however other processes write meanwhile.
+func (p *Plan) openDb(cachePath string) (*sql.DB, error) {
+	tmp, err := os.MkdirTemp("", "8ackyard-dry-run-")
+	if err != nil {
+		return nil, err
+	}
+	p.cachePath = tmp
+	if fs.FileExists(DbName(cachePath)) {
+		db, err := sql.Open("sqlite3", "file:"+DbName(cachePath)+"?mode=ro")
+		if err != nil {
+			return nil, err
+		}
+		_, err = db.Exec("vacuum into ?", DbName(tmp))
+		db.Close()
+		if err != nil {
+			return nil, fmt.Errorf("plan: copy of %v - %v", DbName(cachePath), err)
+		}
+	}
+	log.Infof("plan: dry run on a copy of the db in %v", tmp)
+	return CreateDb(tmp)
+}
+
+// close removes the temporary cache.
+func (p *Plan) close() {
+	if p.cachePath != "" {
+		os.RemoveAll(p.cachePath)
+	}
+}
+
+// taken tells if dest is planned for another id than id, else plans it for id. always false if p is nil.
+func (p *Plan) taken(dest string, id int64) bool {
+	if p == nil {
+		return false
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if other, ok := p.dests[dest]; ok && other != id {
+		return true
+	}
+	p.dests[dest] = id
+	return false
+}
+
+// add records what the backup of fb, sent back by BackupWorker, would do.
+func (p *Plan) add(fb *File8) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for _, c := range fb.conflicts_ {
+		p.Entries = append(p.Entries, PlanEntry{Action: PlanConflict, Id: c.Id, Name: c.Name, Size: c.Size,
+			Reason: string(c.Reason) + " with " + c.OtherName})
+	}
+	switch {
+	case fb.plan_ != nil:
+		p.Entries = append(p.Entries, *fb.plan_)
+	case fb.Size > 0 && fb.Name != "":
+		p.Kept++
+	}
+}
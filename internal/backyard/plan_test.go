@@ -0,0 +1,87 @@
+package backyard
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlan(t *testing.T) {
+	dir, backupPath, cachePath := t.TempDir(), t.TempDir(), t.TempDir()
+	names := []string{filepath.Join(dir, "a", "IMG_1.jpg"), filepath.Join(dir, "b", "IMG_1.jpg"), filepath.Join(dir, "notes.txt")}
+	mimes := []string{"image", "image", "document"}
+
+	db, err := CreateDb(cachePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for i, name := range names {
+		os.MkdirAll(filepath.Dir(name), 0755)
+		os.WriteFile(name, []byte("content of "+name), 0644)
+		id, sum, _ := fileHashes(name)
+		_, mtime, size := fileStat(name)
+		_, err := db.Exec(`insert into files(name, hostname, id, size, timemodified, timeborn, timebornsrc, mimetype, mimesubtype, info, timezone, sha256)
+                                   values(?, 'h', ?, ?, ?, 1560333010, 'meta', ?, '', '', 'UTC', ?)`, name, id, size, mtime.Unix(), mimes[i], sum)
+		assert.NoError(t, err)
+	}
+
+	plan := NewPlan()
+	layout, _ := NewLayout("{{.Year}}/{{.Basename}}")
+	backup_start(IndexOptions{BackupPath: backupPath, CachePath: cachePath, Hostname: "h", Layout: layout, Plan: plan}, db)
+
+	assert.Equal(t, 2, plan.Count(PlanCopy))
+	assert.Equal(t, 1, plan.Count(PlanSkip))
+	dests := make(map[string]bool)
+	for _, e := range plan.Entries {
+		if e.Action == PlanCopy {
+			dests[e.Dest] = true
+			assert.Equal(t, filepath.Join(backupPath, "2019"), filepath.Dir(e.Dest))
+		}
+	}
+	assert.Len(t, dests, 2, "same name planned apart")
+	assert.Equal(t, int64(len("content of "+names[0])+len("content of "+names[1])), plan.CopyBytes())
+
+	entries, _ := os.ReadDir(backupPath)
+	assert.Len(t, entries, 0, "backup untouched")
+}
+
+func TestPlanDb(t *testing.T) {
+	cachePath := t.TempDir()
+	db, err := CreateDb(cachePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Exec("insert into files(name, hostname, id, size) values('/a/IMG_1.jpg', 'h', 1, 3)")
+
+	plan := NewPlan()
+	copied, err := plan.openDb(cachePath) // while db is open
+	if !assert.NoError(t, err) {
+		return
+	}
+	var n int
+	copied.QueryRow("select count(*) from files").Scan(&n)
+	assert.Equal(t, 1, n)
+	copied.Exec("delete from files")
+	db.QueryRow("select count(*) from files").Scan(&n)
+	assert.Equal(t, 1, n, "original untouched")
+
+	copied.Close()
+	db.Close()
+	plan.close()
+	assert.NoDirExists(t, plan.cachePath)
+}
+
+func TestPlanNoHash(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "IMG_1.jpg")
+	os.WriteFile(name, []byte("content"), 0644)
+	_, hashed := newFileIndex(name, nil, true)
+	_, fi := newFileIndex(name, nil, false)
+	if assert.NotNil(t, fi) && assert.NotNil(t, hashed) {
+		assert.Equal(t, "", fi.Sha256)
+		assert.NotEqual(t, hashed.Id, fi.Id)
+		assert.Equal(t, hashed.Size, fi.Size)
+	}
+}
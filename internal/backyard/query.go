@@ -0,0 +1,316 @@
+package backyard
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Query is a filter over indexed files, parsed from terms like
+//
+//	mime:video born:2019-06..2019-08 host:nas size:>1G camera:"iPhone 12"
+//
+// terms are and-ed, a term prefixed by - is negated, and a bare word matches the file name.
+type Query struct {
+	Where string
+	Args  []interface{}
+}
+
+// QueryResult is an indexed file matched by a query, with its backup and metadata if any.
+type QueryResult struct {
+	Id          int64           `json:"id"`
+	Name        string          `json:"name"`
+	Hostname    string          `json:"hostname"`
+	Size        int64           `json:"size"`
+	TimeBorn    int64           `json:"timeborn"`
+	TimeBornSrc TimeBornSrcType `json:"timebornsrc"`
+	TimeZone    string          `json:"timezone"`
+	MIMEType    string          `json:"mimetype"`
+	MIMESubtype string          `json:"mimesubtype"`
+	Backup      string          `json:"backup,omitempty"`
+	Meta        *MediaMeta      `json:"meta,omitempty"`
+}
+
+// queryTerms splits expr into terms by spaces outside double quotes, which are removed.
+func queryTerms(expr string) ([]string, error) {
+	var terms []string
+	var term strings.Builder
+	quoted, started := false, false
+	for _, r := range expr {
+		switch {
+		case r == '"':
+			quoted, started = !quoted, true
+		case unicode.IsSpace(r) && !quoted:
+			if started {
+				terms = append(terms, term.String())
+				term.Reset()
+				started = false
+			}
+		default:
+			term.WriteRune(r)
+			started = true
+		}
+	}
+	if quoted {
+		return nil, fmt.Errorf("query: unterminated quote in %q", expr)
+	}
+	if started {
+		terms = append(terms, term.String())
+	}
+	return terms, nil
+}
+
+// ParseQuery parses expr into a query, reading dates of born: in loc.
+func ParseQuery(expr string, loc *time.Location) (*Query, error) {
+	terms, err := queryTerms(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	q := &Query{}
+	var clauses []string
+	for _, term := range terms {
+		not := false
+		if strings.HasPrefix(term, "-") && len(term) > 1 {
+			not, term = true, term[1:]
+		}
+
+		key, value := "", term
+		if i := strings.Index(term, ":"); i > 0 {
+			key, value = strings.ToLower(term[:i]), term[i+1:]
+		}
+		if value == "" {
+			return nil, fmt.Errorf("query: empty value of %q", term)
+		}
+
+		clause, args, err := queryClause(key, value, loc)
+		if err != nil {
+			return nil, err
+		}
+		if not {
+			clause = "not (" + clause + ")"
+		}
+		clauses = append(clauses, clause)
+		q.Args = append(q.Args, args...)
+	}
+
+	if len(clauses) == 0 {
+		q.Where = "1"
+	} else {
+		q.Where = strings.Join(clauses, " and ")
+	}
+	return q, nil
+}
+
+// likeEscaper escapes the wildcards of like in a value, by escape '\'.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// queryClause returns the sql condition of a term key:value
+func queryClause(key, value string, loc *time.Location) (string, []interface{}, error) {
+	like := "%" + likeEscaper.Replace(value) + "%"
+	switch key {
+	case "": // bare word
+		return `f.name like ? escape '\'`, []interface{}{like}, nil
+	case "name":
+		if strings.ContainsAny(value, "*?[") {
+			return "f.name glob ?", []interface{}{value}, nil
+		}
+		return `f.name like ? escape '\'`, []interface{}{like}, nil
+	case "ext":
+		return `lower(f.name) like ? escape '\'`, []interface{}{"%." + likeEscaper.Replace(strings.ToLower(strings.TrimPrefix(value, ".")))}, nil
+	case "mime":
+		if i := strings.Index(value, "/"); i > 0 {
+			return "f.mimetype=? and f.mimesubtype=?", []interface{}{value[:i], value[i+1:]}, nil
+		}
+		return "f.mimetype=?", []interface{}{value}, nil
+	case "host":
+		return "f.hostname=?", []interface{}{value}, nil
+	case "src":
+		return "f.timebornsrc=?", []interface{}{value}, nil
+	case "id":
+		id, err := strconv.ParseUint(value, 16, 64)
+		if err != nil {
+			return "", nil, fmt.Errorf("query: invalid id %q, hex expected", value)
+		}
+		return "f.id=?", []interface{}{int64(id)}, nil
+	case "camera":
+		return `(m.cameramodel like ? escape '\' or m.cameramake like ? escape '\')`, []interface{}{like, like}, nil
+	case "lens":
+		return `m.lensmodel like ? escape '\'`, []interface{}{like}, nil
+	case "album":
+		return `f.id in (select id from albums where album like ? escape '\')`, []interface{}{like}, nil
+	case "backup":
+		switch strings.ToLower(value) {
+		case "yes", "true":
+			return "coalesce(z.name, '')!=''", nil, nil
+		case "no", "false":
+			return "coalesce(z.name, '')=''", nil, nil
+		}
+		return `z.name like ? escape '\'`, []interface{}{like}, nil
+	case "born":
+		return queryRange("f.timeborn", value, func(s string) (int64, int64, error) {
+			return queryPeriod(s, loc)
+		})
+	case "size":
+		return queryRange("f.size", value, func(s string) (int64, int64, error) {
+			n, err := querySize(s)
+			return n, n + 1, err
+		})
+	case "duration":
+		return queryRange("m.duration", value, func(s string) (int64, int64, error) {
+			n, err := queryDuration(s)
+			return n, n + 1, err
+		})
+	}
+
+	return "", nil, fmt.Errorf("query: unknown key %q", key)
+}
+
+// queryRange returns the sql condition of col in a range like a..b, a.., ..b, >a, >=a, <a, <=a or a,
+// where parse returns the values a stands for, from lo to hi exclusive.
+func queryRange(col, value string, parse func(string) (lo, hi int64, err error)) (string, []interface{}, error) {
+	ops := []struct {
+		prefix string
+		cond   func(lo, hi int64) (string, int64)
+	}{
+		{">=", func(lo, hi int64) (string, int64) { return col + ">=?", lo }},
+		{"<=", func(lo, hi int64) (string, int64) { return col + "<?", hi }},
+		{">", func(lo, hi int64) (string, int64) { return col + ">=?", hi }},
+		{"<", func(lo, hi int64) (string, int64) { return col + "<?", lo }},
+	}
+	for _, op := range ops {
+		if strings.HasPrefix(value, op.prefix) {
+			lo, hi, err := parse(strings.TrimPrefix(value, op.prefix))
+			if err != nil {
+				return "", nil, err
+			}
+			cond, arg := op.cond(lo, hi)
+			return cond, []interface{}{arg}, nil
+		}
+	}
+
+	from, to := value, value
+	if i := strings.Index(value, ".."); i >= 0 {
+		from, to = value[:i], value[i+2:]
+	}
+	var conds []string
+	var args []interface{}
+	if from != "" {
+		lo, _, err := parse(from)
+		if err != nil {
+			return "", nil, err
+		}
+		conds, args = append(conds, col+">=?"), append(args, lo)
+	}
+	if to != "" {
+		_, hi, err := parse(to)
+		if err != nil {
+			return "", nil, err
+		}
+		conds, args = append(conds, col+"<?"), append(args, hi)
+	}
+	if len(conds) == 0 {
+		return "", nil, fmt.Errorf("query: empty range of %v", col)
+	}
+	return strings.Join(conds, " and "), args, nil
+}
+
+// queryPeriod returns the unix times a date like 2019, 2019-06 or 2019-06-01 spans in loc.
+func queryPeriod(s string, loc *time.Location) (lo, hi int64, err error) {
+	for _, p := range []struct {
+		layout string
+		next   func(t time.Time) time.Time
+	}{
+		{"2006-01-02", func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }},
+		{"2006-01", func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }},
+		{"2006", func(t time.Time) time.Time { return t.AddDate(1, 0, 0) }},
+	} {
+		if t, err := time.ParseInLocation(p.layout, s, loc); err == nil {
+			return t.Unix(), p.next(t).Unix(), nil
+		}
+	}
+	return 0, 0, fmt.Errorf("query: invalid date %q, like 2019, 2019-06 or 2019-06-01 expected", s)
+}
+
+// querySize parses a size in bytes like 1234, 100K, 1.5M or 1G, by 1024.
+func querySize(s string) (int64, error) {
+	units := map[byte]float64{'K': 1 << 10, 'M': 1 << 20, 'G': 1 << 30, 'T': 1 << 40}
+	s = strings.TrimSuffix(strings.ToUpper(s), "B")
+	mult := 1.0
+	if n := len(s); n > 0 && units[s[n-1]] > 0 {
+		mult, s = units[s[n-1]], s[:n-1]
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || f < 0 {
+		return 0, fmt.Errorf("query: invalid size %q, like 1234, 100K or 1G expected", s)
+	}
+	return int64(f * mult), nil
+}
+
+// queryDuration parses a duration in seconds like 90, 10m or 1h30m.
+func queryDuration(s string) (int64, error) {
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return n, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("query: invalid duration %q, like 90, 10m or 1h30m expected", s)
+	}
+	return int64(d.Seconds()), nil
+}
+
+// Find returns indexed files matching the query, at most limit if > 0.
+func (q *Query) Find(cachePath string, limit int) ([]QueryResult, error) {
+	db, err := OpenDb(cachePath)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	return findFiles(db, "", q.Where, "f.timeborn, f.name", q.Args, limit)
+}
+
+// findFiles returns indexed files with their backup and metadata, joined with from, matching where, at most limit if > 0.
+func findFiles(db *sql.DB, from, where, orderBy string, args []interface{}, limit int) ([]QueryResult, error) {
+	sqlQuery := `select f.id, f.name, f.hostname, f.size, coalesce(f.timeborn, 0), coalesce(f.timebornsrc, ''), f.timezone,
+                     coalesce(f.mimetype, ''), coalesce(f.mimesubtype, ''),
+                     coalesce(z.name, ''), m.id is not null,
+                     coalesce(m.cameramake, ''), coalesce(m.cameramodel, ''), coalesce(m.lensmodel, ''), coalesce(m.software, ''),
+                     coalesce(m.lat, 0), coalesce(m.lng, 0), coalesce(m.altitude, 0), coalesce(m.duration, 0), coalesce(m.fps, 0),
+                     coalesce(m.codec, ''), coalesce(m.width, 0), coalesce(m.height, 0), coalesce(m.title, ''),
+                     coalesce(m.description, ''), coalesce(m.keywords, ''), coalesce(m.artist, '')
+                     from ` + from + ` files f left join filez z on z.id=f.id left join media_meta m on m.id=f.id
+                     where ` + where + ` order by ` + orderBy
+	if limit > 0 {
+		sqlQuery += " limit ?"
+		args = append(append([]interface{}{}, args...), limit)
+	}
+
+	rows, err := db.Query(sqlQuery, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query: %v", err)
+	}
+	defer rows.Close()
+
+	var results []QueryResult
+	for rows.Next() {
+		var r QueryResult
+		var hasMeta bool
+		m := &MediaMeta{}
+		if err := rows.Scan(&r.Id, &r.Name, &r.Hostname, &r.Size, &r.TimeBorn, &r.TimeBornSrc, &r.TimeZone, &r.MIMEType, &r.MIMESubtype,
+			&r.Backup, &hasMeta,
+			&m.CameraMake, &m.CameraModel, &m.LensModel, &m.Software, &m.Lat, &m.Lng, &m.Altitude, &m.Duration, &m.FPS,
+			&m.Codec, &m.Width, &m.Height, &m.Title, &m.Description, &m.Keywords, &m.Artist); err != nil {
+			return nil, fmt.Errorf("query: %v", err)
+		}
+		if hasMeta {
+			m.Id, r.Meta = r.Id, m
+		}
+		results = append(results, r)
+	}
+
+	return results, rows.Err()
+}
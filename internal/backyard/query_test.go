@@ -0,0 +1,106 @@
+package backyard
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseQuery(t *testing.T) {
+	berlin, _ := time.LoadLocation("Europe/Berlin")
+
+	t.Run("terms", func(t *testing.T) {
+		q, err := ParseQuery(`mime:video host:nas size:>1G camera:"iPhone 12" -ext:mov`, berlin)
+		assert.NoError(t, err)
+		assert.Equal(t, `f.mimetype=? and f.hostname=? and f.size>=? and (m.cameramodel like ? escape '\' or m.cameramake like ? escape '\') and not (lower(f.name) like ? escape '\')`, q.Where)
+		assert.Equal(t, []interface{}{"video", "nas", int64(1<<30 + 1), "%iPhone 12%", "%iPhone 12%", "%.mov"}, q.Args)
+	})
+
+	t.Run("born", func(t *testing.T) {
+		q, err := ParseQuery("born:2019-06..2019-08", berlin)
+		assert.NoError(t, err)
+		assert.Equal(t, "f.timeborn>=? and f.timeborn<?", q.Where)
+		assert.Equal(t, []interface{}{time.Date(2019, 6, 1, 0, 0, 0, 0, berlin).Unix(), time.Date(2019, 9, 1, 0, 0, 0, 0, berlin).Unix()}, q.Args)
+
+		q, _ = ParseQuery("born:2019", berlin)
+		assert.Equal(t, []interface{}{time.Date(2019, 1, 1, 0, 0, 0, 0, berlin).Unix(), time.Date(2020, 1, 1, 0, 0, 0, 0, berlin).Unix()}, q.Args)
+
+		q, _ = ParseQuery("born:<=2019-06-30", berlin)
+		assert.Equal(t, "f.timeborn<?", q.Where)
+		assert.Equal(t, []interface{}{time.Date(2019, 7, 1, 0, 0, 0, 0, berlin).Unix()}, q.Args)
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		q, err := ParseQuery("  ", berlin)
+		assert.NoError(t, err)
+		assert.Equal(t, "1", q.Where)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		for _, expr := range []string{`camera:"iPhone`, "size:>lots", "born:june", "color:red", "id:xyz", "mime:", "born:.."} {
+			_, err := ParseQuery(expr, berlin)
+			assert.Error(t, err, expr)
+		}
+	})
+}
+
+func TestQuerySize(t *testing.T) {
+	for s, n := range map[string]int64{"1234": 1234, "100K": 100 << 10, "1.5M": 3 << 19, "1G": 1 << 30, "2gb": 2 << 30} {
+		size, err := querySize(s)
+		assert.NoError(t, err, s)
+		assert.Equal(t, n, size, s)
+	}
+}
+
+func TestQueryFind(t *testing.T) {
+	cachePath := t.TempDir()
+	db, err := CreateDb(cachePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []File8{
+		{Id: 1, Name: "/mnt/media/IMG_0001.JPG", Size: 100, TimeBorn: 1560000000, MIMEType: "image", MIMESubtype: "jpeg"},
+		{Id: 2, Name: "/mnt/media/MOV_0002.MOV", Size: 2 << 30, TimeBorn: 1565000000, MIMEType: "video", MIMESubtype: "quicktime"},
+		{Id: 3, Name: "/mnt/media/MOV_0003.MP4", Size: 3 << 30, TimeBorn: 1600000000, MIMEType: "video", MIMESubtype: "mp4"},
+		{Id: 4, Name: "/mnt/media/MOVX0004.MP4", Size: 100, TimeBorn: 1600000000, MIMEType: "video", MIMESubtype: "mp4"},
+	} {
+		_, err := db.Exec(`insert into files(name, hostname, id, size, timemodified, timeborn, timebornsrc, mimetype, mimesubtype, info)
+                                   values(?, 'nas', ?, ?, 0, ?, 'meta', ?, ?, '')`, f.Name, f.Id, f.Size, f.TimeBorn, f.MIMEType, f.MIMESubtype)
+		assert.NoError(t, err)
+	}
+	db.Exec(`insert into filez(name, id, size, hostname, timemodified, timeborn, timebornsrc, mimetype, mimesubtype, info)
+                 values('/mnt/backup/video/2019/MOV_0002.MOV', 2, 0, 'nas', 0, 0, 'meta', 'video', '', '')`)
+	dbtx, _ := db.Begin()
+	saveMediaMeta(dbtx, &MediaMeta{Id: 2, CameraModel: "iPhone 12", Duration: 700})
+	dbtx.Commit()
+	db.Close()
+
+	q, err := ParseQuery(`mime:video born:2019-06..2019-08 host:nas size:>1G camera:"iPhone 12"`, time.UTC)
+	assert.NoError(t, err)
+	results, err := q.Find(cachePath, 0)
+	assert.NoError(t, err)
+	if assert.Len(t, results, 1) {
+		assert.Equal(t, "/mnt/media/MOV_0002.MOV", results[0].Name)
+		assert.Equal(t, "/mnt/backup/video/2019/MOV_0002.MOV", results[0].Backup)
+		if assert.NotNil(t, results[0].Meta) {
+			assert.Equal(t, float64(700), results[0].Meta.Duration)
+		}
+	}
+
+	q, _ = ParseQuery("MOV_ backup:no", time.UTC)
+	results, err = q.Find(cachePath, 0)
+	assert.NoError(t, err)
+	if assert.Len(t, results, 1) {
+		assert.Equal(t, "/mnt/media/MOV_0003.MP4", results[0].Name)
+		assert.Nil(t, results[0].Meta)
+	}
+
+	q, _ = ParseQuery("name:100% ext:_P4", time.UTC) // literal, not wildcards
+	results, _ = q.Find(cachePath, 0)
+	assert.Len(t, results, 0)
+
+	q, _ = ParseQuery("", time.UTC)
+	results, _ = q.Find(cachePath, 2)
+	assert.Len(t, results, 2)
+}
@@ -0,0 +1,180 @@
+package backyard
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/njhsi/8ackyard/internal/mutex"
+	"github.com/photoprism/photoprism/pkg/fs"
+)
+
+type RelayoutOptions struct {
+	BackupPath      string
+	CachePath       string
+	Layout          *Layout
+	DocumentsLayout *Layout // of non-media files, DefaultDocumentsLayout if nil
+}
+
+// relayoutMove is a backup file to move in the backup path.
+type relayoutMove struct {
+	Id   int64
+	From string
+	To   string
+}
+
+// Relayout moves existing backup files to where the layout puts them, and updates filez in one transaction.
+// if the transaction fails, moved files are moved back.
+func Relayout(opt RelayoutOptions) (moved int, err error) {
+	db, err := OpenDb(opt.CachePath)
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	if opt.DocumentsLayout == nil {
+		if opt.DocumentsLayout, err = NewLayout(DefaultDocumentsLayout); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := mutex.MainWorker.Start(); err != nil {
+		return 0, err
+	}
+	defer mutex.MainWorker.Stop()
+
+	moves, err := relayoutPlan(opt, db)
+	if err != nil {
+		return 0, err
+	}
+	log.Infof("relayout: %v backup files to move by layout %q", len(moves), opt.Layout)
+
+	dbtx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	done := make([]relayoutMove, 0, len(moves))
+	undo := func() {
+		dbtx.Rollback()
+		for i := len(done) - 1; i >= 0; i-- {
+			if err := os.Rename(done[i].To, done[i].From); err != nil {
+				log.Errorf("relayout: failed moving back %v -> %v - %v", done[i].To, done[i].From, err)
+			}
+		}
+	}
+
+	for _, m := range moves {
+		if mutex.MainWorker.Canceled() {
+			log.Warnf("relayout: canceled, keeping %v files moved", len(done))
+			break
+		}
+		if fs.FileExists(m.To) {
+			log.Warnf("relayout: %v existed, not moving %v there", m.To, m.From)
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(m.To), 0755); err != nil {
+			log.Warnf("relayout: MkdirAll %v - %v", m.To, err)
+			continue
+		}
+		if err := os.Rename(m.From, m.To); err != nil {
+			log.Warnf("relayout: Rename %v -> %v - %v", m.From, m.To, err)
+			continue
+		}
+		done = append(done, m)
+
+		if _, err := dbtx.Exec("update filez set name=? where id=?", m.To, m.Id); err != nil {
+			undo()
+			return 0, err
+		}
+		log.Infof("relayout: moved %v -> %v", m.From, m.To)
+	}
+
+	if err := dbtx.Commit(); err != nil {
+		undo()
+		return 0, err
+	}
+
+	targets := make(map[int64]string)
+	for _, m := range done {
+		targets[m.Id] = m.To
+	}
+	if err := dropLinks(db, targets); err != nil { // alternate names follow the layout too, linked again by the next backup
+		log.Warnf("relayout: dropping links of moved files - %v", err)
+	}
+	for _, m := range done {
+		removeEmptyDirs(filepath.Dir(m.From), opt.BackupPath)
+	}
+
+	return len(done), nil
+}
+
+// relayoutPlan lists backup files not where the layout puts them. sidecars follow their primaries.
+func relayoutPlan(opt RelayoutOptions, db *sql.DB) (moves []relayoutMove, err error) {
+	rows, err := db.Query(`select id, name, hostname, size, timemodified, timeborn, timebornsrc, mimetype, mimesubtype, info, timezone, primaryid
+                               from filez where name!='' order by name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	names, dests := make(map[int64]string), make(map[int64]string)
+	var sidecars []*File8
+	for rows.Next() {
+		f := &File8{}
+		if err := rows.Scan(&f.Id, &f.Name, &f.Hostname, &f.Size, &f.TimeModified, &f.TimeBorn, &f.TimeBornSrc,
+			&f.MIMEType, &f.MIMESubtype, &f.Info, &f.TimeZone, &f.PrimaryId); err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(f.Name, strings.TrimSuffix(opt.BackupPath, "/")+"/") {
+			log.Warnf("relayout: %v is not in backup path %v, skipping", f.Name, opt.BackupPath)
+			continue
+		}
+		names[f.Id], dests[f.Id] = f.Name, f.Name
+		if f.PrimaryId != 0 {
+			sidecars = append(sidecars, f)
+			continue
+		}
+
+		layout := opt.Layout
+		if !isMedia(f.MIMEType) {
+			layout = opt.DocumentsLayout
+		}
+		layoutData := NewLayoutData(f, filepath.Base(f.Name), cachedMeta(opt.CachePath, f.Id))
+		dest, err := layout.Dest(opt.BackupPath, layoutData)
+		if err != nil {
+			return nil, err
+		}
+		if dest != f.Name {
+			dests[f.Id] = dest
+			moves = append(moves, relayoutMove{Id: f.Id, From: f.Name, To: dest})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, f := range sidecars {
+		primary, ok := names[f.PrimaryId]
+		if !ok {
+			log.Warnf("relayout: no primary[%v] of sidecar %v, not moving", Int64ToString(f.PrimaryId), f.Name)
+			continue
+		}
+		if dest := sidecarName(f.Name, primary, dests[f.PrimaryId]); dest != f.Name {
+			moves = append(moves, relayoutMove{Id: f.Id, From: f.Name, To: dest})
+		}
+	}
+
+	return moves, nil
+}
+
+// removeEmptyDirs removes dir and its parents if empty, up to but not including root.
+func removeEmptyDirs(dir, root string) {
+	root = filepath.Clean(root)
+	for dir = filepath.Clean(dir); dir != root && strings.HasPrefix(dir, root+"/"); dir = filepath.Dir(dir) {
+		if err := os.Remove(dir); err != nil {
+			return // not empty
+		}
+	}
+}
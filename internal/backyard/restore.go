@@ -0,0 +1,211 @@
+package backyard
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/njhsi/8ackyard/internal/mutex"
+)
+
+type RestoreOptions struct {
+	CachePath  string
+	Hostname   string
+	Prefix     string    // only files with original path under the dir prefix
+	Since      time.Time // only files born since, if not zero
+	Until      time.Time // only files born before, if not zero
+	Target     string    // re-root under target instead of the original path
+	NumWorkers int
+	Overwrite  bool
+}
+
+type RestoreStatus string
+
+const (
+	RestoreDone     RestoreStatus = "restored"
+	RestoreExisted  RestoreStatus = "existed"  // identical file already there
+	RestoreConflict RestoreStatus = "conflict" // another file there, not overwriting
+	RestoreFailed   RestoreStatus = "failed"
+)
+
+type RestoreJob struct {
+	File     *File8 //original, as indexed in files
+	Source   string //backup file, as in filez
+	Dest     string
+	Opt      RestoreOptions
+	ChResult chan *RestoreResult
+}
+
+type RestoreResult struct {
+	Job    *RestoreJob
+	Status RestoreStatus
+	Err    error
+}
+
+type RestoreSummary struct {
+	Files  int
+	Bytes  int64
+	Status map[RestoreStatus]int
+}
+
+func RestoreWorker(jobs <-chan *RestoreJob) {
+	for job := range jobs {
+		status, err := restoreFile(job)
+		if err != nil {
+			log.Warnf("RestoreWorker: %v -> %v, status=%v err=%v", job.Source, job.Dest, status, err)
+		} else {
+			log.Infof("RestoreWorker: %v -> %v, status=%v", job.Source, job.Dest, status)
+		}
+		job.ChResult <- &RestoreResult{Job: job, Status: status, Err: err}
+	}
+}
+
+// restoreDest returns where the original file name is restored to.
+func restoreDest(name, prefix, target string) string {
+	if target == "" {
+		return name
+	}
+	if prefix != "" {
+		name = strings.TrimPrefix(name, restorePrefix(prefix))
+	}
+	return filepath.Join(target, name)
+}
+
+// restorePrefix returns the dir prefix ending in a slash, not to take /photos/abc for /photos/a.
+func restorePrefix(prefix string) string {
+	if prefix == "" {
+		return ""
+	}
+	return strings.TrimSuffix(prefix, "/") + "/"
+}
+
+func restoreFile(job *RestoreJob) (RestoreStatus, error) {
+	f := job.File
+
+	if err, _, size := fileStat(job.Dest); err == nil {
+		if size == f.Size && sameContent(job.Dest, f.Id, f.Sha256) {
+			return RestoreExisted, nil
+		}
+		if !job.Opt.Overwrite {
+			return RestoreConflict, fmt.Errorf("%v existed with different content", job.Dest)
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(job.Dest), 0755); err != nil {
+		return RestoreFailed, err
+	}
+
+	destTmp := job.Dest + "-" + Int64ToString(f.Id) + ".tmp"
+	if err := CopyWithStat(job.Source, destTmp); err != nil {
+		os.Remove(destTmp)
+		return RestoreFailed, err
+	}
+	if !sameContent(destTmp, f.Id, f.Sha256) {
+		os.Remove(destTmp)
+		return RestoreFailed, fmt.Errorf("copied not identically, expected id=%v sha256=%v", Int64ToString(f.Id), f.Sha256)
+	}
+
+	mtime := time.Unix(f.TimeModified, 0)
+	if err := os.Chtimes(destTmp, mtime, mtime); err != nil {
+		log.Warnf("restore: Chtimes %v - %v", destTmp, err)
+	}
+	if err := os.Rename(destTmp, job.Dest); err != nil {
+		os.Remove(destTmp)
+		return RestoreFailed, err
+	}
+
+	return RestoreDone, nil
+}
+
+// Restore copies backup files back to the original paths of the host, or re-rooted under a target.
+func Restore(opt RestoreOptions) (summary RestoreSummary, err error) {
+	summary.Status = make(map[RestoreStatus]int)
+
+	if len(opt.Hostname) == 0 {
+		opt.Hostname, _ = os.Hostname()
+	}
+
+	db, err := OpenDb(opt.CachePath)
+	if err != nil {
+		return summary, err
+	}
+	defer db.Close()
+
+	if err := mutex.MainWorker.Start(); err != nil {
+		return summary, err
+	}
+	defer mutex.MainWorker.Stop()
+
+	sqlQuery := `select f.name, f.id, f.size, f.timemodified, f.sha256, z.name from files f join filez z on z.id=f.id
+                     where f.hostname=? and z.name!='' and substr(f.name, 1, length(?))=?`
+	prefix := restorePrefix(opt.Prefix)
+	args := []interface{}{opt.Hostname, prefix, prefix}
+	if !opt.Since.IsZero() {
+		sqlQuery = sqlQuery + " and f.timeborn>=?"
+		args = append(args, opt.Since.Unix())
+	}
+	if !opt.Until.IsZero() {
+		sqlQuery = sqlQuery + " and f.timeborn<?"
+		args = append(args, opt.Until.Unix())
+	}
+	sqlQuery = sqlQuery + " order by f.name"
+
+	jobs := make(chan *RestoreJob)
+	chResult := make(chan *RestoreResult, 50)
+
+	var wg sync.WaitGroup
+	numWorkers := opt.NumWorkers
+	if numWorkers == 0 {
+		numWorkers = 3
+	}
+	wg.Add(numWorkers)
+	for i := 0; i < numWorkers; i++ {
+		go func() {
+			RestoreWorker(jobs)
+			wg.Done()
+		}()
+	}
+
+	chResultWait := make(chan bool)
+	go func() {
+		for r := range chResult {
+			summary.Files = summary.Files + 1
+			summary.Status[r.Status] = summary.Status[r.Status] + 1
+			if r.Status == RestoreDone {
+				summary.Bytes = summary.Bytes + r.Job.File.Size
+			}
+		}
+		chResultWait <- true
+	}()
+
+	rows, err := db.Query(sqlQuery, args...)
+	if err == nil {
+		for rows.Next() {
+			if mutex.MainWorker.Canceled() {
+				err = errors.New("restore canceled")
+				break
+			}
+			f := &File8{Hostname: opt.Hostname}
+			job := &RestoreJob{File: f, Opt: opt, ChResult: chResult}
+			if err = rows.Scan(&f.Name, &f.Id, &f.Size, &f.TimeModified, &f.Sha256, &job.Source); err != nil {
+				break
+			}
+			job.Dest = restoreDest(f.Name, opt.Prefix, opt.Target)
+			jobs <- job
+		}
+		rows.Close()
+	}
+
+	close(jobs)
+	wg.Wait()
+	close(chResult)
+	<-chResultWait
+
+	log.Infof("restore: %v files of host[%v], %v bytes restored, %v", summary.Files, opt.Hostname, summary.Bytes, summary.Status)
+
+	return summary, err
+}
@@ -0,0 +1,67 @@
+package backyard
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRestoreDest(t *testing.T) {
+	assert.Equal(t, "/photos/a/x.jpg", restoreDest("/photos/a/x.jpg", "/photos/a", ""))
+	assert.Equal(t, "/mnt/r/x.jpg", restoreDest("/photos/a/x.jpg", "/photos/a", "/mnt/r"))
+	assert.Equal(t, "/mnt/r/x.jpg", restoreDest("/photos/a/x.jpg", "/photos/a/", "/mnt/r"))
+	assert.Equal(t, "/mnt/r/photos/a/x.jpg", restoreDest("/photos/a/x.jpg", "", "/mnt/r"))
+}
+
+func TestRestore(t *testing.T) {
+	originals, backupPath, cachePath := t.TempDir(), t.TempDir(), t.TempDir()
+	db, err := CreateDb(cachePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{filepath.Join(originals, "a", "x.jpg"), filepath.Join(originals, "a", "sub", "y.jpg"), filepath.Join(originals, "abc", "z.jpg")}
+	for i, name := range names {
+		backupName := filepath.Join(backupPath, filepath.Base(name))
+		os.WriteFile(backupName, []byte("content of "+name), 0644)
+		id, sum, _ := fileHashes(backupName)
+		_, err := db.Exec("insert into files(name, hostname, id, size, timemodified, sha256) values(?, 'h', ?, ?, ?, ?)",
+			name, id, len("content of "+name), 1560333010+i, sum)
+		assert.NoError(t, err)
+		_, err = db.Exec(`insert into filez(name, id, size, hostname, timemodified, timeborn, timebornsrc, mimetype, mimesubtype, info, sha256)
+                                   values(?, ?, ?, 'h', 0, 0, 'meta', 'image', '', '', ?)`, backupName, id, len("content of "+name), sum)
+		assert.NoError(t, err)
+	}
+	db.Close()
+
+	t.Run("prefix", func(t *testing.T) {
+		target := t.TempDir()
+		summary, err := Restore(RestoreOptions{CachePath: cachePath, Hostname: "h", Prefix: filepath.Join(originals, "a"), Target: target})
+		assert.NoError(t, err)
+		assert.Equal(t, 2, summary.Status[RestoreDone])
+		data, _ := os.ReadFile(filepath.Join(target, "sub", "y.jpg"))
+		assert.Equal(t, "content of "+names[1], string(data))
+		assert.NoFileExists(t, filepath.Join(target, "bc", "z.jpg"), "abc is not under a")
+	})
+
+	t.Run("in place", func(t *testing.T) {
+		summary, err := Restore(RestoreOptions{CachePath: cachePath, Hostname: "h", Prefix: originals})
+		assert.NoError(t, err)
+		assert.Equal(t, 3, summary.Status[RestoreDone])
+		fi, _ := os.Stat(names[0])
+		assert.Equal(t, int64(1560333010), fi.ModTime().Unix())
+
+		os.WriteFile(names[2], []byte("edited since"), 0644)
+		summary, _ = Restore(RestoreOptions{CachePath: cachePath, Hostname: "h", Prefix: originals})
+		assert.Equal(t, 2, summary.Status[RestoreExisted])
+		assert.Equal(t, 1, summary.Status[RestoreConflict])
+		data, _ := os.ReadFile(names[2])
+		assert.Equal(t, "edited since", string(data), "not overwritten")
+
+		summary, _ = Restore(RestoreOptions{CachePath: cachePath, Hostname: "h", Prefix: originals, Overwrite: true})
+		assert.Equal(t, 1, summary.Status[RestoreDone])
+		data, _ = os.ReadFile(names[2])
+		assert.Equal(t, "content of "+names[2], string(data))
+	})
+}
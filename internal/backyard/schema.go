@@ -0,0 +1,183 @@
+package backyard
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// migration evolves the db schema by one version. never change a released one, append a new one instead.
+type migration struct {
+	Version int
+	Name    string
+	Stmt    string
+}
+
+// migrations are applied in order, each at most once per db.
+var migrations = []migration{
+	{
+		Version: 1,
+		Name:    "create filez and files",
+		// id: xxhash h3 64bit. INT rather than INTEGER of sqlite, constraints non-auto-incremental as primary key needs.
+		// "if not exists", since dbs created before versioning already have them.
+		Stmt: `
+               create table if not exists filez (id int not null, name text not null, hostname text,
+                                   size integer not null, timemodified integer, timeborn integer, timebornsrc text,
+                                   mimetype text, mimesubtype text, info text,
+                                   primary key(id));
+               create table if not exists files (name text not null, hostname text not null, id int not null,
+                                   size integer not null, timemodified integer, timeborn integer, timebornsrc text,
+                                   mimetype text, mimesubtype text, info text,
+                                   primary key(name, hostname));
+               `,
+	},
+	{
+		Version: 2,
+		Name:    "add timezone of birth time",
+		Stmt: `
+               alter table filez add column timezone text not null default '';
+               alter table files add column timezone text not null default '';
+               `,
+	},
+	{
+		Version: 3,
+		Name:    "add primary of sidecars",
+		// id of the media file a sidecar follows into the same backup folder, 0 if not a sidecar.
+		Stmt: `
+               alter table filez add column primaryid int not null default 0;
+               `,
+	},
+	{
+		Version: 4,
+		Name:    "create conflicts",
+		// backup jobs quarantined for manual resolution, name against othername, the file chosen to back up.
+		Stmt: `
+               create table conflicts (id int not null, reason text not null, hostname text not null,
+                                   name text not null, size integer, timeborn integer,
+                                   othername text not null, othersize integer, othertimeborn integer,
+                                   timefound integer, resolution text not null default '',
+                                   primary key(id, reason, name, othername));
+               `,
+	},
+	{
+		Version: 5,
+		Name:    "add sha256",
+		// '' until indexed again or backfilled
+		Stmt: `
+               alter table filez add column sha256 text not null default '';
+               alter table files add column sha256 text not null default '';
+               alter table conflicts add column sha256 text not null default '';
+               alter table conflicts add column othersha256 text not null default '';
+               `,
+	},
+	{
+		Version: 6,
+		Name:    "create albums",
+		// album membership of files, as in Google Takeout
+		Stmt: `
+               create table albums (id int not null, album text not null,
+                                   primary key(id, album));
+               `,
+	},
+	{
+		Version: 7,
+		Name:    "create media_meta",
+		// metadata extracted when indexing, by content id. duration in seconds, keywords comma separated.
+		Stmt: `
+               create table media_meta (id int not null, cameramake text not null default '', cameramodel text not null default '',
+                                   lensmodel text not null default '', software text not null default '',
+                                   lat real not null default 0, lng real not null default 0, altitude integer not null default 0,
+                                   duration real not null default 0, fps real not null default 0, codec text not null default '',
+                                   width integer not null default 0, height integer not null default 0,
+                                   title text not null default '', description text not null default '',
+                                   keywords text not null default '', artist text not null default '',
+                                   primary key(id));
+               create index media_meta_cameramodel on media_meta(cameramodel);
+               `,
+	},
+	{
+		Version: 8,
+		Name:    "create links",
+		// alternate names of backup files in the backup path, kind symlink or hardlink
+		Stmt: `
+               create table links (name text not null, id int not null, kind text not null,
+                                   primary key(name));
+               create index links_id on links(id);
+               `,
+	},
+	{
+		Version: 9,
+		Name:    "create backup_journal",
+		// backup jobs of the run going on, or interrupted, by content id. state planned, running or done.
+		Stmt: `
+               create table backup_journal (id int not null, state text not null, timeupdated integer not null default 0,
+                                   primary key(id));
+               `,
+	},
+	{
+		Version: 10,
+		Name:    "create backfill_meta",
+		// ids indexed before media_meta, to fill media_meta and media_fts of from the cached exiftool json, once
+		Stmt: `
+               create table backfill_meta (id int not null, primary key(id));
+               insert into backfill_meta(id) select distinct id from files where mimetype!='sidecar'
+                                   and id not in (select id from media_meta);
+               `,
+	},
+}
+
+// SchemaVersion returns the latest schema version known.
+func SchemaVersion() int {
+	return migrations[len(migrations)-1].Version
+}
+
+// dbVersion returns the schema version of db, 0 if never migrated.
+func dbVersion(db *sql.DB) (version int, err error) {
+	row := db.QueryRow("select coalesce(max(version), 0) from schema_version")
+	err = row.Scan(&version)
+	return version, err
+}
+
+// migrateDb brings the schema of db up to date.
+func migrateDb(db *sql.DB) error {
+	sqlStmt := `create table if not exists schema_version (version integer not null, name text, timeapplied integer,
+                                   primary key(version));`
+	if _, err := db.Exec(sqlStmt); err != nil {
+		return fmt.Errorf("schema: %v", err)
+	}
+
+	version, err := dbVersion(db)
+	if err != nil {
+		return fmt.Errorf("schema: %v", err)
+	}
+	if version > SchemaVersion() {
+		return fmt.Errorf("schema: db version %v is newer than %v, upgrade 8ackyard", version, SchemaVersion())
+	}
+
+	for _, m := range migrations {
+		if m.Version <= version {
+			continue
+		}
+
+		dbtx, err := db.Begin()
+		if err != nil {
+			return fmt.Errorf("schema: Begin %v", err)
+		}
+		if _, err := dbtx.Exec(m.Stmt); err != nil {
+			dbtx.Rollback()
+			return fmt.Errorf("schema: migration %v (%v) failed - %v", m.Version, m.Name, err)
+		}
+		if _, err := dbtx.Exec("insert into schema_version(version, name, timeapplied) values(?, ?, ?)",
+			m.Version, m.Name, time.Now().Unix()); err != nil {
+			dbtx.Rollback()
+			return fmt.Errorf("schema: migration %v (%v) failed - %v", m.Version, m.Name, err)
+		}
+		if err := dbtx.Commit(); err != nil {
+			return fmt.Errorf("schema: migration %v (%v) failed - %v", m.Version, m.Name, err)
+		}
+
+		log.Infof("schema: migrated db to version %v, %v", m.Version, m.Name)
+	}
+
+	return nil
+}
@@ -0,0 +1,92 @@
+package backyard
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMigrateDb(t *testing.T) {
+	t.Run("new", func(t *testing.T) {
+		cachePath := t.TempDir()
+
+		db, err := CreateDb(cachePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+
+		version, err := dbVersion(db)
+		assert.NoError(t, err)
+		assert.Equal(t, SchemaVersion(), version)
+
+		_, err = db.Exec("insert into files(name, hostname, id, size) values('/a.jpg', 'h', 1, 1)")
+		assert.NoError(t, err)
+	})
+
+	t.Run("unversioned", func(t *testing.T) {
+		cachePath := t.TempDir()
+
+		db, err := sql.Open("sqlite3", DbName(cachePath))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = db.Exec(`create table files (name text not null, hostname text not null, id int not null,
+                                   size integer not null, timemodified integer, timeborn integer, timebornsrc text,
+                                   mimetype text, mimesubtype text, info text,
+                                   primary key(name, hostname));
+                          insert into files(name, hostname, id, size) values('/a.jpg', 'h', 1, 1);`)
+		assert.NoError(t, err)
+		db.Close()
+
+		db, err = OpenDb(cachePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+
+		version, err := dbVersion(db)
+		assert.NoError(t, err)
+		assert.Equal(t, SchemaVersion(), version)
+
+		var count int
+		assert.NoError(t, db.QueryRow("select count(*) from files").Scan(&count))
+		assert.Equal(t, 1, count)
+	})
+
+	t.Run("again", func(t *testing.T) {
+		cachePath := t.TempDir()
+
+		db, err := CreateDb(cachePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+
+		assert.NoError(t, migrateDb(db))
+
+		var count int
+		assert.NoError(t, db.QueryRow("select count(*) from schema_version").Scan(&count))
+		assert.Equal(t, len(migrations), count)
+	})
+
+	t.Run("newer", func(t *testing.T) {
+		cachePath := t.TempDir()
+
+		db, err := CreateDb(cachePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+
+		_, err = db.Exec("insert into schema_version(version, name) values(?, 'future')", SchemaVersion()+1)
+		assert.NoError(t, err)
+		assert.Error(t, migrateDb(db))
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		_, err := OpenDb(t.TempDir())
+		assert.Error(t, err)
+	})
+}
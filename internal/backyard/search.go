@@ -0,0 +1,151 @@
+package backyard
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/njhsi/8ackyard/internal/meta"
+)
+
+// SearchDoc is the text of a file by content id, full-text searchable in table media_fts.
+type SearchDoc struct {
+	Id          int64
+	Title       string
+	Description string
+	Subject     string
+	Keywords    string
+	Notes       string
+	Artist      string
+}
+
+// newSearchDoc returns the searchable text of id in data, or nil if none.
+func newSearchDoc(id int64, data *meta.Data) *SearchDoc {
+	d := &SearchDoc{
+		Id:          id,
+		Title:       data.Title,
+		Description: data.Description,
+		Subject:     data.Subject,
+		Keywords:    data.Keywords.String(),
+		Notes:       data.Notes,
+		Artist:      data.Artist,
+	}
+	if *d == (SearchDoc{Id: id}) {
+		return nil
+	}
+	return d
+}
+
+// errNoFts5 is returned for the search index by builds without fts5.
+var errNoFts5 = errors.New("search: not in this build, build with -tags sqlite_fts5")
+
+var fts5Once sync.Once
+var fts5 bool
+
+// hasFts5 tells if sqlite of this build has fts5, by -tags sqlite_fts5, checked once and warned of if not.
+func hasFts5(db *sql.DB) bool {
+	fts5Once.Do(func() {
+		var used int
+		err := db.QueryRow("select sqlite_compileoption_used('ENABLE_FTS5')").Scan(&used)
+		fts5 = err == nil && used == 1
+		if !fts5 {
+			log.Warnf("search: no full-text search index in this build, build with -tags sqlite_fts5 for it")
+		}
+	})
+	return fts5
+}
+
+// createSearchIndex creates the fts5 table media_fts, if not existed, filled from media_meta.
+// it is not a migration, as fts5 is only in builds with -tags sqlite_fts5, and it fails without, by errNoFts5.
+// a build without marks an existing media_fts stale, as it can not keep it in sync, and one with rebuilds it then.
+func createSearchIndex(db *sql.DB) error {
+	var n, stale int
+	if err := db.QueryRow(`select count(*), coalesce(sum(name='media_fts_stale'), 0) from sqlite_master
+                               where name in ('media_fts', 'media_fts_stale')`).Scan(&n, &stale); err != nil {
+		return err
+	}
+	exists := n > stale
+	if !hasFts5(db) {
+		if exists && stale == 0 {
+			if _, err := db.Exec("create table if not exists media_fts_stale (timemarked integer)"); err != nil {
+				return err
+			}
+			log.Warnf("search: media_fts is left out of sync by this build, to rebuild by one with -tags sqlite_fts5")
+		}
+		return errNoFts5
+	}
+	if exists && stale == 0 {
+		return nil
+	}
+
+	dbtx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if stale > 0 {
+		log.Infof("search: rebuilding media_fts, left out of sync by a build without fts5")
+		if _, err := dbtx.Exec("drop table if exists media_fts; drop table media_fts_stale"); err != nil {
+			dbtx.Rollback()
+			return err
+		}
+	}
+	if _, err := dbtx.Exec(`create virtual table media_fts using fts5(title, description, subject, keywords, notes, artist,
+                                tokenize='unicode61 remove_diacritics 2')`); err != nil {
+		dbtx.Rollback()
+		return err
+	}
+	if _, err := dbtx.Exec(`insert into media_fts(rowid, title, description, subject, keywords, notes, artist)
+                                select id, title, description, '', keywords, '', artist from media_meta
+                                where title!='' or description!='' or keywords!='' or artist!=''`); err != nil {
+		dbtx.Rollback()
+		return err
+	}
+	return dbtx.Commit()
+}
+
+// searchIndexed tells if media_fts is there to keep in sync, in a build with fts5 and not left stale by one without.
+func searchIndexed(db *sql.DB) bool {
+	if !hasFts5(db) {
+		return false
+	}
+	var n int
+	err := db.QueryRow("select count(*) from sqlite_master where name='media_fts' and not exists (select 1 from sqlite_master where name='media_fts_stale')").Scan(&n)
+	return err == nil && n > 0
+}
+
+// saveSearchDoc replaces the searchable text of id in db, removing it if d is nil.
+func saveSearchDoc(dbtx *sql.Tx, id int64, d *SearchDoc) error {
+	if _, err := dbtx.Exec("delete from media_fts where rowid=?", id); err != nil {
+		return err
+	}
+	if d == nil {
+		return nil
+	}
+	_, err := dbtx.Exec(`insert into media_fts(rowid, title, description, subject, keywords, notes, artist)
+                             values(?, ?, ?, ?, ?, ?, ?)`, id, d.Title, d.Description, d.Subject, d.Keywords, d.Notes, d.Artist)
+	return err
+}
+
+// Search returns indexed files whose text matches the fts5 query, like "birthday cake" or birth*, best ranked first,
+// at most limit if > 0.
+func Search(cachePath, text string, limit int) ([]QueryResult, error) {
+	db, err := OpenDb(cachePath)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	if err := createSearchIndex(db); err == errNoFts5 {
+		return nil, err
+	} else if err != nil {
+		return nil, fmt.Errorf("search: %v", err)
+	}
+
+	results, err := findFiles(db, "media_fts s join", "s.rowid=f.id and media_fts match ?", "bm25(media_fts), f.name",
+		[]interface{}{text}, limit)
+	if err != nil {
+		return nil, fmt.Errorf("search: %v", err)
+	}
+	return results, nil
+}
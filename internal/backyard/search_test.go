@@ -0,0 +1,77 @@
+package backyard
+
+import (
+	"testing"
+
+	"github.com/njhsi/8ackyard/internal/meta"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSearch(t *testing.T) {
+	assert.Nil(t, newSearchDoc(1, &meta.Data{CameraModel: "X-T3"}))
+
+	cachePath := t.TempDir()
+	db, err := CreateDb(cachePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for i, name := range []string{"/mnt/media/cake.jpg", "/mnt/media/party.jpg", "/mnt/media/beach.jpg"} {
+		_, err := db.Exec(`insert into files(name, hostname, id, size, timemodified, timeborn, timebornsrc, mimetype, mimesubtype, info)
+                                   values(?, 'h', ?, 1, 0, 0, 'meta', 'image', 'jpeg', '')`, name, i+1)
+		assert.NoError(t, err)
+	}
+	dbtx, _ := db.Begin()
+	saveMediaMeta(dbtx, &MediaMeta{Id: 3, Title: "Beach", Keywords: "panorama"}) // indexed before the search index
+	dbtx.Commit()
+
+	if err := createSearchIndex(db); err != nil {
+		assert.Equal(t, errNoFts5, err)
+		t.Skipf("no fts5 in this build, -tags sqlite_fts5 - %v", err)
+	}
+
+	dbtx, _ = db.Begin()
+	assert.NoError(t, saveSearchDoc(dbtx, 1, newSearchDoc(1, &meta.Data{Title: "Birthday cake", Keywords: meta.Keywords{"hdr"}})))
+	assert.NoError(t, saveSearchDoc(dbtx, 2, newSearchDoc(2, &meta.Data{Description: "a birthday party, no cake"})))
+	assert.NoError(t, dbtx.Commit())
+
+	results, err := Search(cachePath, "birthday cake", 0)
+	assert.NoError(t, err)
+	if assert.Len(t, results, 2) {
+		assert.Equal(t, "/mnt/media/cake.jpg", results[0].Name) // title is short, ranked first
+	}
+
+	results, _ = Search(cachePath, "panorama", 0)
+	if assert.Len(t, results, 1) {
+		assert.Equal(t, "/mnt/media/beach.jpg", results[0].Name)
+	}
+
+	dbtx, _ = db.Begin()
+	assert.NoError(t, saveSearchDoc(dbtx, 1, nil)) // re-indexed without text
+	assert.NoError(t, dbtx.Commit())
+	results, _ = Search(cachePath, "cake", 0)
+	if assert.Len(t, results, 1) {
+		assert.Equal(t, "/mnt/media/party.jpg", results[0].Name)
+	}
+
+	_, err = Search(cachePath, `"unterminated`, 0)
+	assert.Error(t, err)
+
+	t.Run("stale", func(t *testing.T) { // marked by a build without fts5, which indexed meanwhile
+		_, err := db.Exec("create table media_fts_stale (timemarked integer)")
+		assert.NoError(t, err)
+		dbtx, _ := db.Begin()
+		saveMediaMeta(dbtx, &MediaMeta{Id: 2, Title: "Sunset"})
+		dbtx.Commit()
+
+		results, err := Search(cachePath, "sunset", 0)
+		assert.NoError(t, err)
+		if assert.Len(t, results, 1) {
+			assert.Equal(t, "/mnt/media/party.jpg", results[0].Name)
+		}
+		var n int
+		db.QueryRow("select count(*) from sqlite_master where name='media_fts_stale'").Scan(&n)
+		assert.Equal(t, 0, n, "rebuilt")
+	})
+}
@@ -0,0 +1,137 @@
+package backyard
+
+import (
+	"database/sql"
+	"path/filepath"
+	"strings"
+)
+
+// MIMETypeSidecar marks indexed sidecar files, whose MIMESubtype is the extension, like aae.
+const MIMETypeSidecar = "sidecar"
+
+// DefaultSidecars are extensions of sidecar files, which follow their primary media files.
+var DefaultSidecars = []string{".aae", ".xmp", ".json", ".thm", ".lrv"}
+
+// Sidecars is a set of lowercase sidecar extensions with dot.
+type Sidecars map[string]bool
+
+// NewSidecars returns the set of sidecar extensions, DefaultSidecars if nil, none if empty.
+func NewSidecars(exts []string) Sidecars {
+	if exts == nil {
+		exts = DefaultSidecars
+	}
+
+	s := make(Sidecars)
+	for _, ext := range exts {
+		ext = strings.ToLower(strings.TrimSpace(ext))
+		if ext == "" {
+			continue
+		}
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		s[ext] = true
+	}
+
+	return s
+}
+
+// With returns a copy of s with ext added, s left as is.
+func (s Sidecars) With(ext string) Sidecars {
+	c := make(Sidecars, len(s)+1)
+	for e := range s {
+		c[e] = true
+	}
+	c[strings.ToLower(ext)] = true
+	return c
+}
+
+// Is tells if fileName is a sidecar by its extension.
+func (s Sidecars) Is(fileName string) bool {
+	return s[strings.ToLower(filepath.Ext(fileName))]
+}
+
+// isMedia tells if mime type is backed up by the layout, rather than as a document or sidecar.
+func isMedia(mimeType string) bool {
+	return mimeType == "video" || mimeType == "audio" || mimeType == "image"
+}
+
+// SidecarOf tells the primary media file of an indexed sidecar, and where the primary is backed up.
+type SidecarOf struct {
+	File    *File8 // the indexed sidecar
+	Primary string // indexed name of the primary
+	Backup  *File8 // backup of the primary, in filez
+}
+
+// sidecarStem returns the name without the sidecar extension,
+// so IMG_0001.AAE gives IMG_0001, and IMG_0001.JPG.json of takeout gives IMG_0001.JPG
+func sidecarStem(fileName string) string {
+	return strings.TrimSuffix(fileName, filepath.Ext(fileName))
+}
+
+// sidecarName returns the name of sidecar following primary renamed to primaryNew, in the folder of primaryNew.
+func sidecarName(sidecar, primary, primaryNew string) string {
+	base, primaryBase, primaryNewBase := filepath.Base(sidecar), filepath.Base(primary), filepath.Base(primaryNew)
+
+	switch {
+	case strings.HasPrefix(base, primaryBase): // IMG_0001.JPG.json
+		base = primaryNewBase + strings.TrimPrefix(base, primaryBase)
+	case strings.HasPrefix(base, sidecarStem(primaryBase)): // IMG_0001.AAE
+		base = sidecarStem(primaryNewBase) + strings.TrimPrefix(base, sidecarStem(primaryBase))
+	case strings.ToLower(filepath.Ext(base)) == ".json": // IMG_0001.jpg(1).json of takeout, for IMG_0001(1).jpg
+		base = primaryNewBase + filepath.Ext(base)
+	}
+
+	return filepath.Join(filepath.Dir(primaryNew), base)
+}
+
+// findSidecarOf finds the backed up primary media file of the indexed sidecar fi, or nil if none.
+// a primary is in the same folder, named as the sidecar without its extension, or with another extension,
+// or for a json of Google Takeout, by the names takeout gives.
+func findSidecarOf(dbtx *sql.Tx, fi *File8) *SidecarOf {
+	stem := sidecarStem(fi.Name)
+	prefix := stem + "."
+
+	s := querySidecarOf(dbtx, fi, "(f.name=? or substr(f.name, 1, length(?))=?) order by f.name=? desc, f.mimetype, f.name",
+		[]interface{}{stem, prefix, prefix, stem}, func(primary string) bool {
+			// IMG_0001.x.JPG is not the primary of IMG_0001.AAE
+			return primary == stem || !strings.Contains(strings.TrimPrefix(primary, prefix), ".")
+		})
+	if s == nil && strings.ToLower(filepath.Ext(fi.Name)) == ".json" {
+		s = findTakeoutPrimary(dbtx, fi)
+	}
+	return s
+}
+
+// querySidecarOf returns the first backed up file of the host in the folder of sidecar fi, matching where and accepted.
+func querySidecarOf(dbtx *sql.Tx, fi *File8, where string, args []interface{}, accept func(primary string) bool) *SidecarOf {
+	rows, err := dbtx.Query(`select f.name, z.id, z.name, z.hostname, z.size, z.timemodified, z.timeborn, z.timebornsrc,
+                                 z.mimetype, z.mimesubtype, z.info, z.timezone
+                                 from files f join filez z on z.id=f.id
+                                 where f.hostname=? and f.mimetype!=? and `+where,
+		append([]interface{}{fi.Hostname, MIMETypeSidecar}, args...)...)
+	if err != nil {
+		log.Warnf("findSidecarOf: %v - %v", fi.Name, err)
+		return nil
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		s := &SidecarOf{File: fi, Backup: &File8{}}
+		b := s.Backup
+		if err := rows.Scan(&s.Primary, &b.Id, &b.Name, &b.Hostname, &b.Size, &b.TimeModified, &b.TimeBorn, &b.TimeBornSrc,
+			&b.MIMEType, &b.MIMESubtype, &b.Info, &b.TimeZone); err != nil {
+			log.Warnf("findSidecarOf: %v - %v", fi.Name, err)
+			return nil
+		}
+		if b.Name == "" || filepath.Dir(s.Primary) != filepath.Dir(fi.Name) {
+			continue // not backed up
+		}
+		if !accept(s.Primary) {
+			continue
+		}
+		return s
+	}
+
+	return nil
+}
@@ -0,0 +1,83 @@
+package backyard
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSidecars(t *testing.T) {
+	s := NewSidecars(nil)
+	assert.True(t, s.Is("/mnt/media/IMG_0001.AAE"))
+	assert.True(t, s.Is("/mnt/media/IMG_0001.JPG.json"))
+	assert.True(t, s.Is("/mnt/media/GX010001.LRV"))
+	assert.False(t, s.Is("/mnt/media/IMG_0001.JPG"))
+
+	s = NewSidecars([]string{"AAE", " .Xmp "})
+	assert.True(t, s.Is("/mnt/media/IMG_0001.aae"))
+	assert.True(t, s.Is("/mnt/media/IMG_0001.XMP"))
+	assert.False(t, s.Is("/mnt/media/IMG_0001.JPG.json"))
+
+	withJson := s.With(".JSON")
+	assert.True(t, withJson.Is("/mnt/media/IMG_0001.JPG.json"))
+	assert.False(t, s.Is("/mnt/media/IMG_0001.JPG.json"), "left as is")
+
+	s = NewSidecars([]string{})
+	assert.False(t, s.Is("/mnt/media/IMG_0001.AAE"))
+}
+
+func TestSidecarName(t *testing.T) {
+	assert.Equal(t, "/mnt/backup/image/2020/IMG_0001.AAE",
+		sidecarName("/mnt/media/IMG_0001.AAE", "/mnt/media/IMG_0001.JPG", "/mnt/backup/image/2020/IMG_0001.JPG"))
+	assert.Equal(t, "/mnt/backup/image/2020/IMG_1.AAE",
+		sidecarName("/mnt/media/IMG_0001.AAE", "/mnt/media/IMG_0001.JPG", "/mnt/backup/image/2020/IMG_1.JPG"))
+	assert.Equal(t, "/mnt/backup/image/2020/IMG_1.JPG.json",
+		sidecarName("/mnt/media/IMG_0001.JPG.json", "/mnt/media/IMG_0001.JPG", "/mnt/backup/image/2020/IMG_1.JPG"))
+	assert.Equal(t, "/mnt/backup/image/2020/other.xmp",
+		sidecarName("/mnt/media/other.xmp", "/mnt/media/IMG_0001.JPG", "/mnt/backup/image/2020/IMG_0001.JPG"))
+}
+
+func TestFindSidecarOf(t *testing.T) {
+	db, err := CreateDb(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	files := []File8{
+		{Id: 1, Name: "/mnt/media/IMG_0001.JPG", MIMEType: "image"},
+		{Id: 2, Name: "/mnt/media/IMG_0001.MOV", MIMEType: "video"},
+		{Id: 3, Name: "/mnt/media/IMG_0001.AAE", MIMEType: MIMETypeSidecar},
+		{Id: 4, Name: "/mnt/media/IMG_0001.x.JPG", MIMEType: "image"},
+		{Id: 5, Name: "/mnt/media/IMG_0002.MOV", MIMEType: "video"},
+		{Id: 6, Name: "/mnt/media/IMG_0002.MOV.json", MIMEType: MIMETypeSidecar},
+		{Id: 7, Name: "/mnt/media/sub/IMG_0003.JPG", MIMEType: "image"},
+		{Id: 8, Name: "/mnt/media/IMG_0003.xmp", MIMEType: MIMETypeSidecar},
+	}
+	for _, f := range files {
+		_, err := db.Exec("insert into files(name, hostname, id, size, mimetype) values(?, 'h', ?, 1, ?)", f.Name, f.Id, f.MIMEType)
+		assert.NoError(t, err)
+	}
+	for _, id := range []int64{1, 2, 4, 5, 7} {
+		_, err := db.Exec(`insert into filez(name, id, size, hostname, timemodified, timeborn, timebornsrc, mimetype, mimesubtype, info)
+                                   values(?, ?, 1, 'h', 0, 0, 'stat', '', '', '')`, "/mnt/backup/"+Int64ToString(id), id)
+		assert.NoError(t, err)
+	}
+
+	dbtx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbtx.Rollback()
+
+	if s := findSidecarOf(dbtx, &File8{Name: "/mnt/media/IMG_0001.AAE", Hostname: "h"}); assert.NotNil(t, s) {
+		assert.Equal(t, "/mnt/media/IMG_0001.JPG", s.Primary)
+		assert.Equal(t, int64(1), s.Backup.Id)
+	}
+	if s := findSidecarOf(dbtx, &File8{Name: "/mnt/media/IMG_0002.MOV.json", Hostname: "h"}); assert.NotNil(t, s) {
+		assert.Equal(t, "/mnt/media/IMG_0002.MOV", s.Primary)
+		assert.Equal(t, "/mnt/backup/"+Int64ToString(5), s.Backup.Name)
+	}
+	assert.Nil(t, findSidecarOf(dbtx, &File8{Name: "/mnt/media/IMG_0003.xmp", Hostname: "h"}))
+	assert.Nil(t, findSidecarOf(dbtx, &File8{Name: "/mnt/media/IMG_0001.AAE", Hostname: "other"}))
+}
@@ -0,0 +1,138 @@
+package backyard
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Count is a number of files and their bytes.
+type Count struct {
+	Files int64 `json:"files"`
+	Bytes int64 `json:"bytes"`
+}
+
+// HostStatus is statistics of the indexed files of a host, or of all hosts if Hostname is empty.
+type HostStatus struct {
+	Hostname       string           `json:"hostname,omitempty"`
+	Count                           // rows in files
+	Ids            int64            `json:"ids"`             // distinct content
+	DuplicateRatio float64          `json:"duplicate_ratio"` // of rows being duplicates of another, 1 - ids/files
+	NotBackedUp    Count            `json:"not_backed_up"`   // whose id is not in filez yet
+	ByMIME         map[string]Count `json:"by_mime"`
+	ByTimeBornSrc  map[string]int64 `json:"by_timebornsrc"`
+	ByYear         map[string]int64 `json:"by_year"` // of birth in utc
+}
+
+// BackupStatus is statistics of backup files in filez.
+type BackupStatus struct {
+	Count
+	Orphaned  Count `json:"orphaned"`  // whose sources are not indexed on any host anymore
+	Conflicts int64 `json:"conflicts"` // unresolved
+}
+
+// Status is statistics of the catalog, overall and per host.
+type Status struct {
+	SchemaVersion int          `json:"schema_version"`
+	Overall       HostStatus   `json:"overall"`
+	Hosts         []HostStatus `json:"hosts"`
+	Backup        BackupStatus `json:"backup"`
+}
+
+// CatalogStatus returns statistics of the catalog in the cache.
+func CatalogStatus(cachePath string) (*Status, error) {
+	db, err := OpenDb(cachePath)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	s := &Status{}
+	if s.SchemaVersion, err = dbVersion(db); err != nil {
+		return nil, fmt.Errorf("status: %v", err)
+	}
+
+	var hosts []string
+	rows, err := db.Query("select distinct hostname from files order by hostname")
+	if err != nil {
+		return nil, fmt.Errorf("status: %v", err)
+	}
+	for rows.Next() {
+		var host string
+		if err := rows.Scan(&host); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("status: %v", err)
+		}
+		hosts = append(hosts, host)
+	}
+	rows.Close()
+
+	if err := hostStatus(db, "", &s.Overall); err != nil {
+		return nil, err
+	}
+	for _, host := range hosts {
+		h := HostStatus{Hostname: host}
+		if err := hostStatus(db, host, &h); err != nil {
+			return nil, err
+		}
+		s.Hosts = append(s.Hosts, h)
+	}
+
+	row := db.QueryRow(`select count(*), coalesce(sum(size), 0),
+                            count(case when id not in (select id from files) then 1 end),
+                            coalesce(sum(case when id not in (select id from files) then size end), 0),
+                            (select count(*) from conflicts where resolution='')
+                            from filez where name!=''`)
+	b := &s.Backup
+	if err := row.Scan(&b.Files, &b.Bytes, &b.Orphaned.Files, &b.Orphaned.Bytes, &b.Conflicts); err != nil {
+		return nil, fmt.Errorf("status: %v", err)
+	}
+
+	return s, nil
+}
+
+// hostStatus fills h with statistics of files of host, or of all hosts if empty.
+func hostStatus(db *sql.DB, host string, h *HostStatus) error {
+	cond := "(?='' or f.hostname=?)"
+
+	row := db.QueryRow(`select count(*), coalesce(sum(f.size), 0), count(distinct f.id),
+                            count(z.id is null or null), coalesce(sum(case when z.id is null then f.size end), 0)
+                            from files f left join filez z on z.id=f.id and z.name!=''
+                            where `+cond, host, host)
+	if err := row.Scan(&h.Files, &h.Bytes, &h.Ids, &h.NotBackedUp.Files, &h.NotBackedUp.Bytes); err != nil {
+		return fmt.Errorf("status: %v", err)
+	}
+	if h.Files > 0 {
+		h.DuplicateRatio = 1 - float64(h.Ids)/float64(h.Files)
+	}
+
+	h.ByMIME = make(map[string]Count)
+	h.ByTimeBornSrc = make(map[string]int64)
+	h.ByYear = make(map[string]int64)
+	groups := []struct {
+		key  string
+		into func(key string, c Count)
+	}{
+		{"coalesce(f.mimetype, '')", func(key string, c Count) { h.ByMIME[key] = c }},
+		{"coalesce(f.timebornsrc, '')", func(key string, c Count) { h.ByTimeBornSrc[key] = c.Files }},
+		{"coalesce(strftime('%Y', f.timeborn, 'unixepoch'), '')", func(key string, c Count) { h.ByYear[key] = c.Files }},
+	}
+	for _, g := range groups {
+		rows, err := db.Query(`select `+g.key+`, count(*), coalesce(sum(f.size), 0) from files f
+                                       where `+cond+` group by 1`, host, host)
+		if err != nil {
+			return fmt.Errorf("status: %v", err)
+		}
+		for rows.Next() {
+			var key string
+			var c Count
+			if err := rows.Scan(&key, &c.Files, &c.Bytes); err != nil {
+				rows.Close()
+				return fmt.Errorf("status: %v", err)
+			}
+			g.into(key, c)
+		}
+		rows.Close()
+	}
+
+	return nil
+}
@@ -0,0 +1,54 @@
+package backyard
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCatalogStatus(t *testing.T) {
+	cachePath := t.TempDir()
+	db, err := CreateDb(cachePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []File8{
+		{Id: 1, Name: "/mnt/media/a.jpg", Hostname: "nas", Size: 10, TimeBorn: 1560000000, TimeBornSrc: TimeBornSrcMeta, MIMEType: "image"},
+		{Id: 1, Name: "/mnt/media/copy/a.jpg", Hostname: "nas", Size: 10, TimeBorn: 1560000000, TimeBornSrc: TimeBornSrcMeta, MIMEType: "image"},
+		{Id: 2, Name: "/mnt/media/b.mov", Hostname: "nas", Size: 100, TimeBorn: 1600000000, TimeBornSrc: TimeBornSrcName, MIMEType: "video"},
+		{Id: 1, Name: "/home/a.jpg", Hostname: "laptop", Size: 10, TimeBorn: 1560000000, TimeBornSrc: TimeBornSrcMeta, MIMEType: "image"},
+	} {
+		_, err := db.Exec(`insert into files(name, hostname, id, size, timemodified, timeborn, timebornsrc, mimetype, mimesubtype, info)
+                                   values(?, ?, ?, ?, 0, ?, ?, ?, '', '')`, f.Name, f.Hostname, f.Id, f.Size, f.TimeBorn, f.TimeBornSrc, f.MIMEType)
+		assert.NoError(t, err)
+	}
+	for _, z := range []File8{{Id: 1, Name: "/mnt/backup/a.jpg", Size: 10}, {Id: 3, Name: "/mnt/backup/gone.jpg", Size: 5}} {
+		_, err := db.Exec(`insert into filez(name, id, size, hostname, timemodified, timeborn, timebornsrc, mimetype, mimesubtype, info)
+                                   values(?, ?, ?, 'nas', 0, 0, 'meta', 'image', '', '')`, z.Name, z.Id, z.Size)
+		assert.NoError(t, err)
+	}
+	db.Close()
+
+	s, err := CatalogStatus(cachePath)
+	assert.NoError(t, err)
+	assert.Equal(t, SchemaVersion(), s.SchemaVersion)
+
+	o := s.Overall
+	assert.Equal(t, Count{Files: 4, Bytes: 130}, o.Count)
+	assert.Equal(t, int64(2), o.Ids)
+	assert.Equal(t, 0.5, o.DuplicateRatio)
+	assert.Equal(t, Count{Files: 1, Bytes: 100}, o.NotBackedUp)
+	assert.Equal(t, Count{Files: 3, Bytes: 30}, o.ByMIME["image"])
+	assert.Equal(t, map[string]int64{"meta": 3, "name": 1}, o.ByTimeBornSrc)
+	assert.Equal(t, map[string]int64{"2019": 3, "2020": 1}, o.ByYear)
+
+	if assert.Len(t, s.Hosts, 2) {
+		assert.Equal(t, "laptop", s.Hosts[0].Hostname)
+		assert.Equal(t, int64(1), s.Hosts[0].Files)
+		assert.Equal(t, "nas", s.Hosts[1].Hostname)
+		assert.Equal(t, Count{Files: 3, Bytes: 120}, s.Hosts[1].Count)
+	}
+
+	assert.Equal(t, Count{Files: 2, Bytes: 15}, s.Backup.Count)
+	assert.Equal(t, Count{Files: 1, Bytes: 5}, s.Backup.Orphaned)
+}
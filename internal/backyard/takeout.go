@@ -0,0 +1,103 @@
+package backyard
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/njhsi/8ackyard/internal/meta"
+	"github.com/photoprism/photoprism/pkg/fs"
+)
+
+// takeoutNameMax is how many characters of the media name Google Takeout keeps in its json name, before .json
+const takeoutNameMax = 46
+
+// takeoutAlbumJson is the json of an album folder in Google Takeout, with albumData.
+const takeoutAlbumJson = "metadata.json"
+
+// takeoutNumRegexp matches a duplicate name like IMG_0001(1).jpg, whose json is IMG_0001.jpg(1).json
+var takeoutNumRegexp = regexp.MustCompile(`^(.*)(\(\d+\))(\.[^.]*)$`)
+
+// takeoutJsonNumRegexp matches the json stem of a duplicate name, like IMG_0001.jpg(1)
+var takeoutJsonNumRegexp = regexp.MustCompile(`^(.*)\(\d+\)$`)
+
+// takeoutJsonNames returns the names of json Google Takeout may give to media base name, by priority.
+// takeout truncates long names, moves a (1) suffix behind the extension, and shares the json with -edited copies.
+func takeoutJsonNames(base string) []string {
+	name, num := base, ""
+	if m := takeoutNumRegexp.FindStringSubmatch(base); m != nil {
+		name, num = m[1]+m[3], m[2]
+	}
+
+	var names []string
+	add := func(s string) {
+		if r := []rune(s); len(r) > takeoutNameMax {
+			s = string(r[:takeoutNameMax])
+		}
+		s = s + num + ".json"
+		for _, n := range names {
+			if n == s {
+				return
+			}
+		}
+		names = append(names, s)
+	}
+
+	add(name) // IMG_0001.jpg.json
+	if stem := sidecarStem(name); strings.HasSuffix(stem, "-edited") {
+		add(strings.TrimSuffix(stem, "-edited") + filepath.Ext(name))
+	}
+	add(sidecarStem(name)) // IMG_0001.json
+
+	return names
+}
+
+// findTakeoutJson returns the json of Google Takeout next to fileName, or "" if none.
+func findTakeoutJson(fileName string) string {
+	dir := filepath.Dir(fileName)
+	for _, name := range takeoutJsonNames(filepath.Base(fileName)) {
+		if jsonName := filepath.Join(dir, name); fs.FileExists(jsonName) {
+			return jsonName
+		}
+	}
+	return ""
+}
+
+// takeoutAlbums returns the album of the folder of fileName, by its metadata.json of Google Takeout.
+func takeoutAlbums(fileName string) []string {
+	jbuf, err := os.ReadFile(filepath.Join(filepath.Dir(fileName), takeoutAlbumJson))
+	if err != nil {
+		return nil
+	}
+	data := &meta.Data{}
+	if err := data.GMeta(jbuf); err != nil {
+		log.Warnf("takeoutAlbums: %v - %v", fileName, err)
+		return nil
+	}
+	return data.Albums
+}
+
+// findTakeoutPrimary finds the backed up media file of an indexed json of Google Takeout,
+// whose name is not simply the media name plus .json, or nil if none.
+func findTakeoutPrimary(dbtx *sql.Tx, fi *File8) *SidecarOf {
+	base := strings.TrimSuffix(filepath.Base(fi.Name), filepath.Ext(fi.Name))
+	if m := takeoutJsonNumRegexp.FindStringSubmatch(base); m != nil {
+		base = m[1]
+	}
+	prefix := filepath.Join(filepath.Dir(fi.Name), sidecarStem(base))
+	if strings.TrimSpace(filepath.Base(prefix)) == "" {
+		return nil
+	}
+
+	jsonBase := filepath.Base(fi.Name)
+	return querySidecarOf(dbtx, fi, "substr(f.name, 1, length(?))=?", []interface{}{prefix, prefix}, func(primary string) bool {
+		for _, name := range takeoutJsonNames(filepath.Base(primary)) {
+			if name == jsonBase {
+				return true
+			}
+		}
+		return false
+	})
+}
@@ -0,0 +1,97 @@
+package backyard
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/njhsi/8ackyard/internal/meta"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTakeoutJsonNames(t *testing.T) {
+	assert.Equal(t, []string{"IMG_0001.jpg.json", "IMG_0001.json"}, takeoutJsonNames("IMG_0001.jpg"))
+	assert.Equal(t, []string{"IMG_0001.jpg(1).json", "IMG_0001(1).json"}, takeoutJsonNames("IMG_0001(1).jpg"))
+	assert.Equal(t, []string{"IMG_0001-edited.jpg.json", "IMG_0001.jpg.json", "IMG_0001-edited.json"},
+		takeoutJsonNames("IMG_0001-edited.jpg"))
+	assert.Equal(t, "Screenshot_2019-05-12-10-00-00-123_com.example.json",
+		takeoutJsonNames("Screenshot_2019-05-12-10-00-00-123_com.example.app.png")[0])
+	assert.Equal(t, "Screenshot_2019-05-12-10-00-00-123_com.example(1).json",
+		takeoutJsonNames("Screenshot_2019-05-12-10-00-00-123_com.example.app(1).png")[0])
+}
+
+func TestTakeoutExtractor(t *testing.T) {
+	dir := t.TempDir()
+	fileName := filepath.Join(dir, "IMG_0001(1).jpg")
+	json := `{"title": "IMG_0001.jpg", "photoTakenTime": {"timestamp": "1557648000", "formatted": "12.05.2019, 08:00:00 UTC"},
+                  "geoData": {"latitude": 52.52, "longitude": 13.405, "altitude": 34.0}}`
+	os.WriteFile(filepath.Join(dir, "IMG_0001.jpg(1).json"), []byte(json), 0644)
+	os.WriteFile(filepath.Join(dir, takeoutAlbumJson), []byte(`{"albumData": {"title": "Holidays"}}`), 0644)
+
+	data := &meta.Data{}
+	assert.NoError(t, TakeoutExtractor{}.Extract(fileName, &File8{}, data))
+	assert.Equal(t, int64(1557648000), data.TakenAt.Unix())
+	assert.Equal(t, "Europe/Berlin", data.TimeZone)
+	assert.Equal(t, float32(52.52), data.Lat)
+	assert.Equal(t, []string{"Holidays"}, takeoutAlbums(fileName))
+
+	assert.Error(t, TakeoutExtractor{}.Extract(filepath.Join(dir, "IMG_0002.jpg"), &File8{}, &meta.Data{}))
+	assert.Nil(t, takeoutAlbums(filepath.Join(t.TempDir(), "IMG_0002.jpg")))
+}
+
+func TestMainIndexTakeout(t *testing.T) {
+	dir := t.TempDir()
+	fileName := filepath.Join(dir, "IMG_0001.jpg")
+	os.WriteFile(fileName, []byte("no exif"), 0644)
+	os.WriteFile(fileName+".json", []byte(`{"photoTakenTime": {"timestamp": "1557648000"}}`), 0644)
+	zones, _ := NewTimeZones("UTC")
+	opt := IndexOptions{CachePath: t.TempDir(), TimeZones: zones, Sidecars: NewSidecars(nil), Takeout: true}
+
+	chDb := make(chan *File8, 1)
+	mainIndex(fileName, nil, opt, &fakeExtractor{name: "fake"}, chDb)
+	fi := <-chDb
+	assert.Equal(t, int64(1557648000), fi.TimeBorn)
+	assert.Equal(t, TimeBornSrcTakeout, fi.TimeBornSrc)
+
+	taken := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC) // by exif, not takeout
+	mainIndex(fileName, nil, opt, &fakeExtractor{name: "fake", takenAt: taken}, chDb)
+	fi = <-chDb
+	assert.Equal(t, taken.Unix(), fi.TimeBorn)
+	assert.Equal(t, TimeBornSrcMeta, fi.TimeBornSrc)
+}
+
+func TestFindTakeoutPrimary(t *testing.T) {
+	db, err := CreateDb(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	long := "/mnt/takeout/Screenshot_2019-05-12-10-00-00-123_com.example.app.png"
+	for i, name := range []string{"/mnt/takeout/IMG_0001.jpg", "/mnt/takeout/IMG_0001(1).jpg", long} {
+		id := int64(i + 1)
+		_, err := db.Exec("insert into files(name, hostname, id, size, mimetype) values(?, 'h', ?, 1, 'image')", name, id)
+		assert.NoError(t, err)
+		_, err = db.Exec(`insert into filez(name, id, size, hostname, timemodified, timeborn, timebornsrc, mimetype, mimesubtype, info)
+                                  values(?, ?, 1, 'h', 0, 0, 'stat', 'image', '', '')`, "/mnt/backup/"+Int64ToString(id), id)
+		assert.NoError(t, err)
+	}
+
+	dbtx, _ := db.Begin()
+	defer dbtx.Rollback()
+	for json, primary := range map[string]string{
+		"/mnt/takeout/IMG_0001.jpg.json":                                   "/mnt/takeout/IMG_0001.jpg",
+		"/mnt/takeout/IMG_0001.jpg(1).json":                                "/mnt/takeout/IMG_0001(1).jpg",
+		"/mnt/takeout/Screenshot_2019-05-12-10-00-00-123_com.example.json": long,
+	} {
+		s := findSidecarOf(dbtx, &File8{Name: json, Hostname: "h"})
+		if assert.NotNil(t, s, json) {
+			assert.Equal(t, primary, s.Primary)
+		}
+	}
+	assert.Nil(t, findSidecarOf(dbtx, &File8{Name: "/mnt/takeout/IMG_0002.jpg(1).json", Hostname: "h"}))
+
+	assert.Equal(t, "/mnt/backup/2019/IMG_1(1).jpg.json",
+		sidecarName("/mnt/takeout/IMG_0001.jpg(1).json", "/mnt/takeout/IMG_0001(1).jpg", "/mnt/backup/2019/IMG_1(1).jpg"))
+}
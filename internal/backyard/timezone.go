@@ -0,0 +1,156 @@
+package backyard
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const DefaultTimeZone = "Asia/Chongqing"
+
+// TimeZoneRule maps files by a path glob, or by a camera model glob, to a time zone.
+type TimeZoneRule struct {
+	Path   string // glob of the file path or any of its parent folders, like /mnt/media/trips/*-berlin
+	Camera string // glob of the camera model, case insensitive, like "iPhone 1*"
+	Zone   string // IANA zone like Europe/Berlin, or an offset like +02:00
+	loc    *time.Location
+}
+
+// TimeZones decides the time zone of naive timestamps found in files, like those in names or in meta without zone.
+type TimeZones struct {
+	Default *time.Location
+	Rules   []TimeZoneRule
+}
+
+// NewTimeZones returns time zones with zone as default and no rules.
+func NewTimeZones(zone string) (*TimeZones, error) {
+	if zone == "" {
+		zone = DefaultTimeZone
+	}
+	loc, err := zoneLocation(zone)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TimeZones{Default: loc}, nil
+}
+
+// LoadRules reads rules from a file, one per line, first matching rule wins:
+//
+//	# comment
+//	path:/mnt/media/trips/2019-berlin  Europe/Berlin
+//	camera:X-T3                        Asia/Tokyo
+//	camera:iPhone 12                   +08:00
+func (z *TimeZones) LoadRules(fileName string) error {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		rule, err := parseTimeZoneRule(line)
+		if err != nil {
+			return fmt.Errorf("timezone: %s line %d - %v", fileName, n, err)
+		}
+		z.Rules = append(z.Rules, rule)
+	}
+
+	return scanner.Err()
+}
+
+func parseTimeZoneRule(line string) (rule TimeZoneRule, err error) {
+	i := strings.LastIndexAny(line, " \t")
+	if i < 0 {
+		return rule, fmt.Errorf("no zone in rule %q", line)
+	}
+	pattern, zone := strings.TrimSpace(line[:i]), line[i+1:]
+
+	switch {
+	case strings.HasPrefix(pattern, "path:"):
+		rule.Path = strings.TrimSuffix(strings.TrimPrefix(pattern, "path:"), "/")
+		_, err = filepath.Match(rule.Path, "")
+	case strings.HasPrefix(pattern, "camera:"):
+		rule.Camera = strings.ToLower(strings.Trim(strings.TrimPrefix(pattern, "camera:"), `"`))
+		_, err = path.Match(rule.Camera, "")
+	default:
+		return rule, fmt.Errorf("rule %q is neither path: nor camera:", line)
+	}
+	if err != nil {
+		return rule, err
+	}
+
+	rule.Zone = zone
+	rule.loc, err = zoneLocation(zone)
+	return rule, err
+}
+
+// Match returns true if the rule applies to the file, taken by the camera model.
+func (r *TimeZoneRule) Match(fileName, cameraModel string) bool {
+	if r.Camera != "" {
+		ok, _ := path.Match(r.Camera, strings.ToLower(cameraModel))
+		return ok && cameraModel != ""
+	}
+
+	for p := filepath.Clean(fileName); p != "/" && p != "."; p = filepath.Dir(p) {
+		if ok, _ := filepath.Match(r.Path, p); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Location returns the time zone of the file, taken by the camera model if known.
+func (z *TimeZones) Location(fileName, cameraModel string) *time.Location {
+	for i := range z.Rules {
+		if z.Rules[i].Match(fileName, cameraModel) {
+			return z.Rules[i].loc
+		}
+	}
+
+	return z.Default
+}
+
+// zoneLocation loads a location by an IANA name, or by an offset like +08:00 / +0800.
+func zoneLocation(zone string) (*time.Location, error) {
+	if strings.HasPrefix(zone, "+") || strings.HasPrefix(zone, "-") {
+		for _, layout := range []string{"-07:00", "-0700", "-07"} {
+			if t, err := time.Parse(layout, zone); err == nil {
+				_, offset := t.Zone()
+				return time.FixedZone(zone, offset), nil
+			}
+		}
+		return nil, fmt.Errorf("timezone: invalid offset %s", zone)
+	}
+
+	return time.LoadLocation(zone)
+}
+
+// ZoneLocation returns the location of a zone recorded in db, or Local if unknown.
+func ZoneLocation(zone string) *time.Location {
+	if zone == "" {
+		return time.Local
+	}
+	loc, err := zoneLocation(zone)
+	if err != nil {
+		log.Warnf("timezone: %v, using local", err)
+		return time.Local
+	}
+	return loc
+}
+
+// inZone reads the wall clock of a naive time t as if it were in loc.
+func inZone(t time.Time, loc *time.Location) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), loc)
+}
@@ -0,0 +1,86 @@
+package backyard
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeZones(t *testing.T) {
+	rulesFile := filepath.Join(t.TempDir(), "timezones")
+	rules := `# trips
+path:/mnt/media/trips/*-berlin  Europe/Berlin
+camera:iPhone 1*                +09:00
+camera:X-T3                     Asia/Tokyo
+`
+	if err := os.WriteFile(rulesFile, []byte(rules), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	z, err := NewTimeZones("Asia/Chongqing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, z.LoadRules(rulesFile))
+	assert.Len(t, z.Rules, 3)
+
+	t.Run("default", func(t *testing.T) {
+		assert.Equal(t, "Asia/Chongqing", z.Location("/mnt/media/2019/a.jpg", "").String())
+	})
+
+	t.Run("path", func(t *testing.T) {
+		assert.Equal(t, "Europe/Berlin", z.Location("/mnt/media/trips/2019-berlin/day1/a.jpg", "").String())
+		assert.Equal(t, "Asia/Chongqing", z.Location("/mnt/media/trips/2019-paris/a.jpg", "").String())
+	})
+
+	t.Run("camera", func(t *testing.T) {
+		assert.Equal(t, "Asia/Tokyo", z.Location("/mnt/media/2019/a.jpg", "x-t3").String())
+		assert.Equal(t, "+09:00", z.Location("/mnt/media/2019/a.jpg", "iPhone 12").String())
+	})
+
+	t.Run("first wins", func(t *testing.T) {
+		assert.Equal(t, "Europe/Berlin", z.Location("/mnt/media/trips/2019-berlin/a.jpg", "X-T3").String())
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := parseTimeZoneRule("path:/a Mars/Olympus")
+		assert.Error(t, err)
+		_, err = parseTimeZoneRule("lens:/a Europe/Berlin")
+		assert.Error(t, err)
+		_, err = parseTimeZoneRule("camera:X-T3")
+		assert.Error(t, err)
+	})
+}
+
+func TestZoneLocation(t *testing.T) {
+	t.Run("offset", func(t *testing.T) {
+		loc, err := zoneLocation("+08:00")
+		assert.NoError(t, err)
+		_, offset := time.Date(2020, 1, 1, 0, 0, 0, 0, loc).Zone()
+		assert.Equal(t, 8*3600, offset)
+
+		loc, err = zoneLocation("-0530")
+		assert.NoError(t, err)
+		_, offset = time.Date(2020, 1, 1, 0, 0, 0, 0, loc).Zone()
+		assert.Equal(t, -(5*3600 + 30*60), offset)
+	})
+
+	t.Run("recorded", func(t *testing.T) {
+		assert.Equal(t, time.Local, ZoneLocation(""))
+		assert.Equal(t, "Europe/Berlin", ZoneLocation("Europe/Berlin").String())
+		assert.Equal(t, "+08:00", ZoneLocation("+08:00").String())
+	})
+}
+
+func TestGuestTimeBorn(t *testing.T) {
+	loc, _ := time.LoadLocation("Europe/Berlin")
+
+	born := guestTimeBorn("/mnt/media/2020-01-03_23-10-10.jpg", loc)
+	assert.Equal(t, "2020-01-03 23:10:10 +0100 CET", born.String())
+	assert.Equal(t, "2020-01-03", born.In(ZoneLocation(loc.String())).Format("2006-01-02"))
+
+	assert.True(t, guestTimeBorn("/mnt/media/a.jpg", loc).IsZero())
+}
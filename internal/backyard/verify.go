@@ -0,0 +1,210 @@
+package backyard
+
+import (
+	"database/sql"
+	"errors"
+	"sync"
+
+	"github.com/njhsi/8ackyard/internal/mutex"
+)
+
+type VerifyStatus string
+
+const (
+	VerifyOk      VerifyStatus = "ok"
+	VerifyMissing VerifyStatus = "missing" // backup file is gone
+	VerifySize    VerifyStatus = "size"    // backup file was resized
+	VerifyMtime   VerifyStatus = "mtime"   // same content, but mtime changed
+	VerifyCorrupt VerifyStatus = "corrupt" // content does not match id or sha256, bit rotten
+
+	VerifyLinkBroken VerifyStatus = "link_broken" // alternate name is gone or not a link of its backup file anymore
+)
+
+// Damaged returns true if the backup file can not be trusted anymore.
+func (s VerifyStatus) Damaged() bool {
+	return s == VerifyMissing || s == VerifySize || s == VerifyCorrupt
+}
+
+type VerifyOptions struct {
+	CachePath  string
+	NumWorkers int
+}
+
+// VerifyReport is one line of the verify report, for a row of filez.
+type VerifyReport struct {
+	Id           string       `json:"id"`
+	Name         string       `json:"name"`
+	Status       VerifyStatus `json:"status"`
+	Size         int64        `json:"size"`
+	SizeDisk     int64        `json:"size_disk,omitempty"`
+	TimeModified int64        `json:"mtime"`
+	MtimeDisk    int64        `json:"mtime_disk,omitempty"`
+	IdDisk       string       `json:"id_disk,omitempty"`
+	Sha256       string       `json:"sha256,omitempty"`
+	Sha256Disk   string       `json:"sha256_disk,omitempty"`
+	Link         LinkMode     `json:"link,omitempty"`    // if Name is an alternate name, linked
+	LinkOf       string       `json:"link_of,omitempty"` // to this backup file
+}
+
+type VerifySummary struct {
+	Checked int
+	Damaged int
+	Status  map[VerifyStatus]int
+}
+
+type VerifyJob struct {
+	File     *File8
+	ChReport chan *VerifyReport
+}
+
+func VerifyWorker(jobs <-chan VerifyJob) {
+	for job := range jobs {
+		job.ChReport <- verifyFile(job.File)
+	}
+}
+
+// verifyFile re-hashes a backup file and compares it with what filez remembers.
+func verifyFile(f *File8) *VerifyReport {
+	r := &VerifyReport{
+		Id:           Int64ToString(f.Id),
+		Name:         f.Name,
+		Size:         f.Size,
+		TimeModified: f.TimeModified,
+		Sha256:       f.Sha256,
+	}
+
+	err, mtime, size := fileStat(f.Name)
+	if len(f.Name) == 0 || err != nil {
+		r.Status = VerifyMissing
+		return r
+	}
+	r.SizeDisk, r.MtimeDisk = size, mtime.Unix()
+
+	if size != f.Size {
+		r.Status = VerifySize
+		return r
+	}
+
+	var id int64
+	var sum string
+	if f.Sha256 != "" { // read once for both
+		id, sum, _ = fileHashes(f.Name)
+		r.Sha256Disk = sum
+	} else {
+		id = int64(fileXXH3(f.Name))
+	}
+	r.IdDisk = Int64ToString(id)
+
+	switch {
+	case id != f.Id || sum != f.Sha256:
+		r.Status = VerifyCorrupt
+	case r.MtimeDisk != f.TimeModified:
+		r.Status = VerifyMtime
+	default:
+		r.Status = VerifyOk
+	}
+
+	return r
+}
+
+// verifyLinks checks alternate names in links are still links of their backup files, sending a report of each.
+func verifyLinks(db *sql.DB, chReport chan *VerifyReport) error {
+	rows, err := db.Query("select l.name, l.id, l.kind, coalesce(z.name, '') from links l left join filez z on z.id=l.id order by l.name")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if mutex.MainWorker.Canceled() {
+			return errors.New("verify canceled")
+		}
+		var id int64
+		r := &VerifyReport{Status: VerifyLinkBroken}
+		if err := rows.Scan(&r.Name, &id, &r.Link, &r.LinkOf); err != nil {
+			return err
+		}
+		r.Id = Int64ToString(id)
+		if r.LinkOf != "" && isLinkOf(r.Link, r.Name, r.LinkOf) {
+			r.Status = VerifyOk
+		}
+		chReport <- r
+	}
+	return rows.Err()
+}
+
+// Verify checks every backup file recorded in filez, and links of their alternate names,
+// and sends a report of each to report.
+func Verify(opt VerifyOptions, report func(r *VerifyReport)) (summary VerifySummary, err error) {
+	summary.Status = make(map[VerifyStatus]int)
+
+	db, err := OpenDb(opt.CachePath)
+	if err != nil {
+		return summary, err
+	}
+	defer db.Close()
+
+	if err := mutex.MainWorker.Start(); err != nil {
+		return summary, err
+	}
+	defer mutex.MainWorker.Stop()
+
+	jobs := make(chan VerifyJob)
+	chReport := make(chan *VerifyReport, 50)
+
+	var wg sync.WaitGroup
+	numWorkers := opt.NumWorkers
+	if numWorkers == 0 {
+		numWorkers = 3
+	}
+	wg.Add(numWorkers)
+	for i := 0; i < numWorkers; i++ {
+		go func() {
+			VerifyWorker(jobs)
+			wg.Done()
+		}()
+	}
+
+	chReportWait := make(chan bool)
+	go func() {
+		for r := range chReport {
+			summary.Checked = summary.Checked + 1
+			summary.Status[r.Status] = summary.Status[r.Status] + 1
+			if r.Status.Damaged() {
+				summary.Damaged = summary.Damaged + 1
+			}
+			report(r)
+		}
+		chReportWait <- true
+	}()
+
+	rows, err := db.Query("select id, name, size, timemodified, sha256 from filez order by name")
+	if err == nil {
+		for rows.Next() {
+			if mutex.MainWorker.Canceled() {
+				err = errors.New("verify canceled")
+				break
+			}
+			f := &File8{}
+			if err = rows.Scan(&f.Id, &f.Name, &f.Size, &f.TimeModified, &f.Sha256); err != nil {
+				break
+			}
+			jobs <- VerifyJob{File: f, ChReport: chReport}
+		}
+		if err == nil {
+			err = rows.Err()
+		}
+		rows.Close()
+	}
+
+	close(jobs)
+	wg.Wait()
+	if err == nil {
+		err = verifyLinks(db, chReport)
+	}
+	close(chReport)
+	<-chReportWait
+
+	log.Infof("verify: checked %v backup files, %v damaged, %v", summary.Checked, summary.Damaged, summary.Status)
+
+	return summary, err
+}
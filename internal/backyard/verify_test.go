@@ -0,0 +1,105 @@
+package backyard
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// backupOf writes a backup file of content, and returns it as recorded in filez.
+func backupOf(t *testing.T, name, content string) *File8 {
+	os.WriteFile(name, []byte(content), 0644)
+	mtime := time.Unix(1560333010, 0)
+	os.Chtimes(name, mtime, mtime)
+	id, sum, err := fileHashes(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &File8{Id: id, Name: name, Size: int64(len(content)), TimeModified: mtime.Unix(), Sha256: sum}
+}
+
+func TestVerifyFile(t *testing.T) {
+	dir := t.TempDir()
+
+	t.Run("ok", func(t *testing.T) {
+		f := backupOf(t, filepath.Join(dir, "ok.jpg"), "ok")
+		assert.Equal(t, VerifyOk, verifyFile(f).Status)
+
+		f.Sha256 = "" // by xxh3 alone
+		assert.Equal(t, VerifyOk, verifyFile(f).Status)
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		f := backupOf(t, filepath.Join(dir, "missing.jpg"), "missing")
+		os.Remove(f.Name)
+		r := verifyFile(f)
+		assert.Equal(t, VerifyMissing, r.Status)
+		assert.True(t, r.Status.Damaged())
+	})
+
+	t.Run("size", func(t *testing.T) {
+		f := backupOf(t, filepath.Join(dir, "size.jpg"), "size")
+		os.WriteFile(f.Name, []byte("resized"), 0644)
+		r := verifyFile(f)
+		assert.Equal(t, VerifySize, r.Status)
+		assert.Equal(t, int64(len("resized")), r.SizeDisk)
+		assert.True(t, r.Status.Damaged())
+	})
+
+	t.Run("mtime", func(t *testing.T) {
+		f := backupOf(t, filepath.Join(dir, "mtime.jpg"), "mtime")
+		mtime := time.Unix(1660333010, 0)
+		os.Chtimes(f.Name, mtime, mtime)
+		r := verifyFile(f)
+		assert.Equal(t, VerifyMtime, r.Status)
+		assert.Equal(t, mtime.Unix(), r.MtimeDisk)
+		assert.False(t, r.Status.Damaged())
+	})
+
+	t.Run("corrupt", func(t *testing.T) {
+		f := backupOf(t, filepath.Join(dir, "corrupt.jpg"), "corrupt")
+		os.WriteFile(f.Name, []byte("corrupT"), 0644) // same size, bit rotten
+		mtime := time.Unix(f.TimeModified, 0)
+		os.Chtimes(f.Name, mtime, mtime)
+		r := verifyFile(f)
+		assert.Equal(t, VerifyCorrupt, r.Status)
+		assert.NotEqual(t, r.Sha256, r.Sha256Disk)
+		assert.True(t, r.Status.Damaged())
+
+		f.Sha256 = ""
+		assert.Equal(t, VerifyCorrupt, verifyFile(f).Status)
+	})
+}
+
+func TestVerify(t *testing.T) {
+	backupPath, cachePath := t.TempDir(), t.TempDir()
+	db, err := CreateDb(cachePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var files []*File8
+	for _, name := range []string{"a.jpg", "b.jpg", "c.jpg"} {
+		files = append(files, backupOf(t, filepath.Join(backupPath, name), "content of "+name))
+	}
+	for _, f := range files {
+		_, err := db.Exec(`insert into filez(name, id, size, hostname, timemodified, timeborn, timebornsrc, mimetype, mimesubtype, info, sha256)
+                                   values(?, ?, ?, 'h', ?, 0, 'meta', 'image', '', '', ?)`, f.Name, f.Id, f.Size, f.TimeModified, f.Sha256)
+		assert.NoError(t, err)
+	}
+	db.Close()
+	os.Remove(files[1].Name)
+
+	reports := make(map[string]VerifyStatus)
+	summary, err := Verify(VerifyOptions{CachePath: cachePath}, func(r *VerifyReport) {
+		reports[r.Name] = r.Status
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, summary.Checked)
+	assert.Equal(t, 1, summary.Damaged)
+	assert.Equal(t, VerifyOk, reports[files[0].Name])
+	assert.Equal(t, VerifyMissing, reports[files[1].Name])
+	assert.Equal(t, VerifyOk, reports[files[2].Name])
+}
@@ -0,0 +1,172 @@
+package backyard
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/karrick/godirwalk"
+)
+
+// DefaultWatchSettle is how long a file must be left unchanged before indexed by watch.
+const DefaultWatchSettle = 5 * time.Second
+
+// watchEvent is a change in a watched dir.
+type watchEvent struct {
+	Name     string
+	Dir      bool
+	Removed  bool // deleted or moved away
+	Overflow bool // events were lost, all must be rescanned
+}
+
+// watcher sends changes in the dirs added, not under them.
+type watcher interface {
+	Add(dir string) error
+	Events() <-chan watchEvent // closed when the watcher is closed
+	Close() error
+}
+
+type WatchOptions struct {
+	IndexOptions
+	Settle time.Duration // DefaultWatchSettle if 0
+	Backup bool          // back up new and changed files as they are indexed, if BackupPath
+
+	Lock func() (unlock func(), err error) // held during each pass if not nil, like against other processes
+}
+
+// Watch indexes opt.Path once fully, then files created or changed under it as they settle,
+// and cleans up index entries of files removed, until ctx is done.
+func (ind *Index) Watch(ctx context.Context, opt WatchOptions) error {
+	if opt.Settle <= 0 {
+		opt.Settle = DefaultWatchSettle
+	}
+	skip := []string{filepath.Clean(opt.CachePath)}
+	if opt.BackupPath != "" {
+		skip = append(skip, filepath.Clean(opt.BackupPath))
+	}
+
+	w, err := newWatcher()
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	// watch before the full pass, not to miss changes made during it
+	pending := make(map[string]time.Time)
+	if err := watchTree(w, opt.Path, skip, nil); err != nil {
+		return err
+	}
+	pass := func(o IndexOptions) error {
+		if opt.Lock != nil {
+			unlock, err := opt.Lock()
+			if err != nil {
+				return err
+			}
+			defer unlock()
+		}
+		ind.Start(o)
+		return nil
+	}
+
+	log.Infof("watch: full pass of %v", opt.Path)
+	if err := pass(opt.IndexOptions); err != nil {
+		return err
+	}
+	log.Infof("watch: watching %v, settling %v", opt.Path, opt.Settle)
+
+	ticker := time.NewTicker(opt.Settle / 2)
+	defer ticker.Stop()
+	removed, rescan := make(map[string]bool), false // names removed since the last pass
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case ev, ok := <-w.Events():
+			if !ok {
+				return errors.New("watch: watcher closed")
+			}
+			switch {
+			case ev.Overflow:
+				log.Warnf("watch: events overflowed, rescanning %v", opt.Path)
+				// dirs created while events were lost are not watched yet
+				if err := watchTree(w, opt.Path, skip, nil); err != nil {
+					log.Warnf("watch: %v", err)
+				}
+				rescan = true
+			case ev.Removed: // of a dir, the files under it too
+				removed[ev.Name] = true
+				delete(pending, ev.Name)
+			case ev.Dir: // created or moved in, with files maybe in it already
+				if err := watchTree(w, ev.Name, skip, pending); err != nil {
+					log.Warnf("watch: %v", err)
+				}
+			default:
+				pending[ev.Name] = time.Now()
+			}
+		case now := <-ticker.C:
+			files := make([]string, 0)
+			for name, t := range pending {
+				if now.Sub(t) >= opt.Settle {
+					files = append(files, name)
+					delete(pending, name)
+				}
+			}
+			if len(files) == 0 && len(removed) == 0 && !rescan {
+				continue
+			}
+			sort.Strings(files)
+
+			batch := opt.IndexOptions
+			batch.Files, batch.Cleanup = files, len(removed) > 0 || rescan
+			if rescan {
+				batch.Files = nil
+			} else if batch.Cleanup { // only the names removed, not the whole tree
+				batch.CleanupFiles = make([]string, 0, len(removed))
+				for name := range removed {
+					batch.CleanupFiles = append(batch.CleanupFiles, name)
+				}
+				sort.Strings(batch.CleanupFiles)
+			}
+			if !opt.Backup {
+				batch.BackupPath = ""
+			}
+			log.Infof("watch: indexing %v settled files, rescan=%v, cleanup=%v", len(files), rescan, batch.Cleanup)
+			if err := pass(batch); err != nil {
+				log.Errorf("watch: %v, trying again later", err)
+				for _, name := range files {
+					pending[name] = now
+				}
+				continue
+			}
+			removed, rescan = make(map[string]bool), false
+		}
+	}
+}
+
+// watchTree adds root and dirs under it to w, but those in skip. files found are made pending if pending is not nil.
+func watchTree(w watcher, root string, skip []string, pending map[string]time.Time) error {
+	return godirwalk.Walk(root, &godirwalk.Options{
+		ErrorCallback: func(fileName string, err error) godirwalk.ErrorAction {
+			log.Warnf("watch: %v", err)
+			return godirwalk.SkipNode
+		},
+		Callback: func(fileName string, info *godirwalk.Dirent) error {
+			if !info.IsDir() {
+				if pending != nil && info.IsRegular() {
+					pending[fileName] = time.Now()
+				}
+				return nil
+			}
+			for _, s := range skip {
+				if fileName == s || strings.HasPrefix(fileName, s+"/") {
+					return filepath.SkipDir
+				}
+			}
+			return w.Add(fileName)
+		},
+		Unsorted: true,
+	})
+}
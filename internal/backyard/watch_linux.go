@@ -0,0 +1,113 @@
+//go:build linux
+
+package backyard
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const inotifyMask = unix.IN_CREATE | unix.IN_CLOSE_WRITE | unix.IN_MODIFY | unix.IN_ATTRIB |
+	unix.IN_MOVED_TO | unix.IN_MOVED_FROM | unix.IN_DELETE
+
+// inotifyWatcher watches dirs by inotify, not recursively.
+type inotifyWatcher struct {
+	fd     int
+	file   *os.File // fd in the runtime poller, so that Close ends a blocking read
+	mutex  sync.Mutex
+	dirs   map[int]string // by watch descriptor
+	events chan watchEvent
+}
+
+func newWatcher() (watcher, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+	w := &inotifyWatcher{
+		fd:     fd,
+		file:   os.NewFile(uintptr(fd), "inotify"),
+		dirs:   make(map[int]string),
+		events: make(chan watchEvent, 1024),
+	}
+	go w.read()
+	return w, nil
+}
+
+func (w *inotifyWatcher) Add(dir string) error {
+	wd, err := unix.InotifyAddWatch(w.fd, dir, inotifyMask|unix.IN_ONLYDIR)
+	if err != nil {
+		return os.NewSyscallError("inotify_add_watch "+dir, err)
+	}
+	w.mutex.Lock()
+	w.dirs[wd] = dir
+	w.mutex.Unlock()
+	return nil
+}
+
+func (w *inotifyWatcher) Events() <-chan watchEvent {
+	return w.events
+}
+
+func (w *inotifyWatcher) Close() error {
+	return w.file.Close()
+}
+
+// forget stops watching dir and dirs under it, moved away.
+func (w *inotifyWatcher) forget(dir string) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	for wd, name := range w.dirs {
+		if name == dir || strings.HasPrefix(name, dir+"/") {
+			unix.InotifyRmWatch(w.fd, uint32(wd))
+			delete(w.dirs, wd)
+		}
+	}
+}
+
+// read sends events read from inotify, until closed.
+func (w *inotifyWatcher) read() {
+	defer close(w.events)
+
+	buf := make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil {
+			return
+		}
+		for off := 0; off+unix.SizeofInotifyEvent <= n; {
+			ev := (*unix.InotifyEvent)(unsafe.Pointer(&buf[off]))
+			nameStart := off + unix.SizeofInotifyEvent
+			off = nameStart + int(ev.Len)
+			if ev.Mask&unix.IN_Q_OVERFLOW != 0 {
+				w.events <- watchEvent{Overflow: true}
+				continue
+			}
+
+			w.mutex.Lock()
+			dir, ok := w.dirs[int(ev.Wd)]
+			if ev.Mask&unix.IN_IGNORED != 0 { // dir removed
+				delete(w.dirs, int(ev.Wd))
+			}
+			w.mutex.Unlock()
+			if !ok || ev.Len == 0 {
+				continue
+			}
+
+			e := watchEvent{
+				Name:    filepath.Join(dir, strings.TrimRight(string(buf[nameStart:off]), "\x00")),
+				Dir:     ev.Mask&unix.IN_ISDIR != 0,
+				Removed: ev.Mask&(unix.IN_DELETE|unix.IN_MOVED_FROM) != 0,
+			}
+			if e.Dir && ev.Mask&unix.IN_MOVED_FROM != 0 {
+				w.forget(e.Name)
+			}
+			w.events <- e
+		}
+	}
+}
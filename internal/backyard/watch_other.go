@@ -0,0 +1,9 @@
+//go:build !linux
+
+package backyard
+
+import "errors"
+
+func newWatcher() (watcher, error) {
+	return nil, errors.New("watch: only supported on linux, by inotify")
+}
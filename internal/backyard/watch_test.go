@@ -0,0 +1,115 @@
+package backyard
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// nextEvent returns the next event of w with name, a removal if removed, failing after a while.
+func nextEvent(t *testing.T, w watcher, name string, removed bool) watchEvent {
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case ev := <-w.Events():
+			if ev.Name == name && ev.Removed == removed {
+				return ev
+			}
+		case <-timeout:
+			t.Fatalf("no event of %v", name)
+		}
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	w, err := newWatcher()
+	if err != nil {
+		t.Skip(err)
+	}
+	defer w.Close()
+
+	root := t.TempDir()
+	sub := filepath.Join(root, "sub")
+	os.Mkdir(sub, 0755)
+	pending := make(map[string]time.Time)
+	os.WriteFile(filepath.Join(sub, "a.jpg"), []byte("a"), 0644)
+	assert.NoError(t, watchTree(w, root, []string{filepath.Join(root, ".cache8")}, pending))
+	assert.Contains(t, pending, filepath.Join(sub, "a.jpg"))
+
+	name := filepath.Join(sub, "b.jpg")
+	os.WriteFile(name, []byte("b"), 0644)
+	ev := nextEvent(t, w, name, false)
+	assert.False(t, ev.Dir)
+
+	os.Remove(name)
+	nextEvent(t, w, name, true)
+
+	dir := filepath.Join(root, "new")
+	os.Mkdir(dir, 0755)
+	ev = nextEvent(t, w, dir, false)
+	assert.True(t, ev.Dir)
+}
+
+func TestWatch(t *testing.T) {
+	if w, err := newWatcher(); err != nil {
+		t.Skip(err)
+	} else {
+		w.Close()
+	}
+
+	root, cachePath := t.TempDir(), t.TempDir()
+	old := filepath.Join(root, "old.jpg")
+	os.WriteFile(old, []byte("old"), 0644)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	watched := make(chan error)
+	go func() {
+		watched <- NewIndex().Watch(ctx, WatchOptions{
+			IndexOptions: IndexOptions{Path: root, CachePath: cachePath, Hostname: "h", NumWorkers: 1},
+			Settle:       200 * time.Millisecond,
+		})
+	}()
+
+	// names indexed of the host, once there are n of them
+	indexed := func(n int) []string {
+		for i := 0; i < 50; i++ {
+			time.Sleep(100 * time.Millisecond)
+			db, err := OpenDb(cachePath)
+			if err != nil {
+				continue
+			}
+			var names []string
+			rows, err := db.Query("select name from files where hostname='h' order by name")
+			if err == nil {
+				for rows.Next() {
+					var name string
+					rows.Scan(&name)
+					names = append(names, name)
+				}
+				rows.Close()
+			}
+			db.Close()
+			if len(names) == n {
+				return names
+			}
+		}
+		return nil
+	}
+
+	assert.Equal(t, []string{old}, indexed(1))
+
+	added := filepath.Join(root, "sub", "new.jpg")
+	os.MkdirAll(filepath.Dir(added), 0755)
+	os.WriteFile(added, []byte("new"), 0644)
+	assert.Equal(t, []string{old, added}, indexed(2))
+
+	os.Remove(old)
+	assert.Equal(t, []string{added}, indexed(1))
+
+	cancel()
+	assert.NoError(t, <-watched)
+}
@@ -1,12 +1,23 @@
 package commands
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"syscall"
+	"time"
 
-	"github.com/njhsi/8ackyard/internal/event"
 	"github.com/photoprism/photoprism/pkg/fs"
 	"github.com/sevlyar/go-daemon"
+	"github.com/urfave/cli"
+
+	"github.com/njhsi/8ackyard/internal/backyard"
+	"github.com/njhsi/8ackyard/internal/config"
+	"github.com/njhsi/8ackyard/internal/event"
+	"github.com/njhsi/8ackyard/internal/mutex"
 )
 
 var log = event.Log
@@ -28,5 +39,135 @@ func childAlreadyRunning(filePath string) (pid int, running bool) {
 		return pid, false
 	}
 
-	return pid, process.Signal(syscall.Signal(0)) == nil
+	if process.Signal(syscall.Signal(0)) != nil {
+		return pid, false
+	}
+
+	// the daemon holds its pid file locked while running, the pid left by a crash may be of another process since
+	lock, err := daemon.OpenLockFile(filePath, 0)
+	if err != nil {
+		return pid, false
+	}
+	defer lock.Close()
+	if err := lock.Lock(); err != daemon.ErrWouldBlock {
+		if err == nil {
+			lock.Unlock()
+		}
+		return pid, false
+	}
+	return pid, true
+}
+
+// cancelOnInterrupt cancels the main worker on the first ctrl+c, and exits hard on the second.
+// the returned func must be called when the command is done.
+func cancelOnInterrupt() func() {
+	contxt, cancel := context.WithCancel(context.Background())
+	signalChan := make(chan os.Signal, 1)
+	signal.Notify(signalChan, os.Interrupt)
+	go func() {
+		select {
+		case <-signalChan: // first signal, cancel context
+			mutex.MainWorker.Cancel()
+			//			cancel()
+		case <-contxt.Done():
+		}
+		<-signalChan // second signal, hard exit
+		os.Exit(2)
+	}()
+
+	return func() {
+		signal.Stop(signalChan)
+		cancel()
+	}
+}
+
+// waitFlag is the --wait flag of commands writing the cache or backup.
+var waitFlag = cli.DurationFlag{
+	Name:  "wait",
+	Usage: "wait so long for another 8ackyard process holding the cache or backup, instead of failing at once",
+}
+
+// lockPaths locks the cache, and the backup path if not empty, against other 8ackyard processes on any host
+// sharing them, waiting up to wait. the returned func unlocks them.
+func lockPaths(wait time.Duration, cachePath, backupPath string) (unlock func(), err error) {
+	var locks []*mutex.FileLock
+	unlock = func() {
+		for i := len(locks) - 1; i >= 0; i-- {
+			locks[i].Unlock()
+		}
+	}
+
+	names := []string{filepath.Join(cachePath, "8ackyard.lock")}
+	if backupPath != "" {
+		names = append(names, filepath.Join(backupPath, ".8ackyard.lock"))
+	}
+	for _, name := range names {
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			unlock()
+			return nil, err
+		}
+		l, err := mutex.Lock(name, wait)
+		if err != nil {
+			unlock()
+			var locked *mutex.LockedError
+			if errors.As(err, &locked) && wait == 0 {
+				err = fmt.Errorf("%v, see --wait", err)
+			}
+			return nil, err
+		}
+		if l.TookOver != nil {
+			log.Warnf("lock: took over %v, left by %v", name, l.TookOver)
+		}
+		locks = append(locks, l)
+	}
+
+	return unlock, nil
+}
+
+// newConfig returns the config, with cache and workers flags of the command taking precedence.
+func newConfig(ctx *cli.Context) (*config.Config, error) {
+	conf, err := config.NewConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if ctx.IsSet("cache") {
+		conf.CacheDir = ctx.String("cache")
+	}
+	if ctx.IsSet("workers") {
+		conf.Workers = ctx.Int("workers")
+	}
+
+	return conf, nil
+}
+
+// newTimeZones returns the time zones as configured.
+func newTimeZones(conf *config.Config) (*backyard.TimeZones, error) {
+	timeZones, err := backyard.NewTimeZones(conf.TimeZone)
+	if err != nil {
+		return nil, err
+	}
+	if conf.TimeZoneRules != "" {
+		if err := timeZones.LoadRules(conf.TimeZoneRules); err != nil {
+			return nil, err
+		}
+	}
+
+	return timeZones, nil
+}
+
+// newLayouts returns the layouts of media and of non-media files, as configured.
+func newLayouts(conf *config.Config) (layout, documentsLayout *backyard.Layout, err error) {
+	if layout, err = backyard.NewLayout(conf.Layout); err != nil {
+		return nil, nil, err
+	}
+	documentsText := conf.DocumentsLayout
+	if documentsText == "" {
+		documentsText = backyard.DefaultDocumentsLayout
+	}
+	if documentsLayout, err = backyard.NewLayout(documentsText); err != nil {
+		return nil, nil, err
+	}
+
+	return layout, documentsLayout, nil
 }
@@ -0,0 +1,133 @@
+package commands
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli"
+
+	"github.com/njhsi/8ackyard/internal/backyard"
+)
+
+// ConflictsCommand registers the conflicts cli command.
+var ConflictsCommand = cli.Command{
+	Name:      "conflicts",
+	Usage:     "Lists backup jobs quarantined for conflicts, or resolves them",
+	ArgsUsage: "[id in hex, to resolve]",
+	Flags:     conflictsFlags,
+	Action:    conflictsAction,
+}
+
+var conflictsFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:  "backup, b",
+		Usage: "backup path, to find the cache in",
+		Value: "",
+	},
+	cli.StringFlag{
+		Name:  "cache, s",
+		Usage: "cache path",
+		Value: "",
+	},
+	cli.BoolFlag{
+		Name:  "all, a",
+		Usage: "list resolved conflicts too",
+	},
+	cli.BoolFlag{
+		Name:  "json, j",
+		Usage: "list as json lines",
+	},
+	cli.BoolFlag{
+		Name:  "accept",
+		Usage: "back up the id anyway by its earliest born file, for size or birth conflicts; refused for sha256 ones, of different contents",
+	},
+	cli.BoolFlag{
+		Name:  "clear",
+		Usage: "forget conflicts of the id, to check it again on next backup after fixing the originals",
+	},
+	waitFlag,
+}
+
+// conflictsAction lists conflicts, or resolves those of the id given
+func conflictsAction(ctx *cli.Context) error {
+	conf, err := newConfig(ctx)
+	if err != nil {
+		return err
+	}
+	cachePath := conf.CachePath(ctx.String("backup"))
+
+	if ctx.Bool("accept") || ctx.Bool("clear") {
+		if ctx.Bool("accept") == ctx.Bool("clear") {
+			return cli.NewExitError("conflicts: either --accept or --clear", 2)
+		}
+		id, err := parseId(ctx.Args().First())
+		if err != nil {
+			return cli.NewExitError(fmt.Sprintf("conflicts: %v", err), 2)
+		}
+
+		unlock, err := lockPaths(ctx.Duration("wait"), cachePath, "")
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+		defer unlock()
+
+		resolution := ""
+		if ctx.Bool("accept") {
+			resolution = backyard.ConflictAccepted
+		}
+		n, err := backyard.ResolveConflicts(cachePath, id, resolution)
+		if err != nil {
+			return cli.NewExitError(err.Error(), 2)
+		}
+		if n == 0 {
+			return cli.NewExitError(fmt.Sprintf("conflicts: no conflicts of id %v", ctx.Args().First()), 1)
+		}
+		log.Infof("conflicts: resolved %d conflicts of id %v", n, ctx.Args().First())
+		return nil
+	}
+
+	conflicts, err := backyard.Conflicts(cachePath, ctx.Bool("all"))
+	if err != nil {
+		return cli.NewExitError(err.Error(), 2)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	for _, c := range conflicts {
+		if ctx.Bool("json") {
+			enc.Encode(c)
+			continue
+		}
+		line := fmt.Sprintf("%v %-5v %v(size=%v born=%v) <> %v(size=%v born=%v)",
+			backyard.Int64ToString(c.Id), c.Reason,
+			c.Name, c.Size, time.Unix(c.TimeBorn, 0).Format(time.RFC3339),
+			c.OtherName, c.OtherSize, time.Unix(c.OtherTimeBorn, 0).Format(time.RFC3339))
+		if c.Reason == backyard.ConflictHash {
+			line += fmt.Sprintf(" sha256=%v <> %v", c.Sha256, c.OtherSha256)
+		}
+		if c.Resolution != "" {
+			line += " " + c.Resolution
+		}
+		fmt.Println(line)
+	}
+
+	return nil
+}
+
+// parseId parses a file id as shown in hex, like 9c3a0e5f4b1d2e77
+func parseId(s string) (int64, error) {
+	buf, err := hex.DecodeString(strings.TrimSpace(s))
+	if err != nil || len(buf) != 8 {
+		return 0, fmt.Errorf("invalid id %q, 16 hex digits expected", s)
+	}
+
+	var id int64
+	for _, b := range buf {
+		id = id<<8 | int64(b)
+	}
+
+	return id, nil
+}
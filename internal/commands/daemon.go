@@ -0,0 +1,243 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/sevlyar/go-daemon"
+	"github.com/urfave/cli"
+
+	"github.com/njhsi/8ackyard/internal/backyard"
+	"github.com/njhsi/8ackyard/internal/config"
+	"github.com/njhsi/8ackyard/internal/mutex"
+	"github.com/njhsi/8ackyard/internal/service"
+)
+
+// StartCommand registers the start cli command.
+var StartCommand = cli.Command{
+	Name:      "start",
+	Usage:     "Starts a daemon indexing and backing up originals on the schedule, see --schedule",
+	ArgsUsage: "[originals subfolder...]",
+	Flags:     startFlags,
+	Action:    startAction,
+}
+
+// StopCommand registers the stop cli command.
+var StopCommand = cli.Command{
+	Name:   "stop",
+	Usage:  "Stops the daemon, canceling the run going on",
+	Flags:  stopFlags,
+	Action: stopAction,
+}
+
+var startFlags = []cli.Flag{
+	cli.BoolFlag{
+		Name:  "cleanup, c",
+		Usage: "remove orphan index entries on each run",
+	},
+	cli.BoolFlag{
+		Name:  "takeout, t",
+		Usage: "pair media with json of Google Takeout, for time taken, geo and albums",
+	},
+	cli.StringFlag{
+		Name:  "backup, b",
+		Usage: "backup to where, after indexing",
+		Value: "",
+	},
+	cli.StringFlag{
+		Name:  "cache, s",
+		Usage: "cache path, where the pid and log files of the daemon are",
+		Value: "",
+	},
+	cli.IntFlag{
+		Name:  "workers, n",
+		Usage: "number of workers",
+		Value: 4,
+	},
+	waitFlag,
+}
+
+var stopFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:  "backup, b",
+		Usage: "backup path, to find the cache in",
+		Value: "",
+	},
+	cli.StringFlag{
+		Name:  "cache, s",
+		Usage: "cache path",
+		Value: "",
+	},
+	cli.DurationFlag{
+		Name:  "timeout",
+		Usage: "how long to wait for the daemon to exit",
+		Value: time.Minute,
+	},
+}
+
+// daemonState is whether the daemon of a cache is running.
+type daemonState struct {
+	Running bool   `json:"running"`
+	Pid     int    `json:"pid,omitempty"`
+	PidFile string `json:"pid_file"`
+	LogFile string `json:"log_file"`
+}
+
+// newDaemonState returns the state of the daemon by its pid file in the cache.
+func newDaemonState(cachePath string) daemonState {
+	s := daemonState{
+		PidFile: filepath.Join(cachePath, "8ackyard.pid"),
+		LogFile: filepath.Join(cachePath, "8ackyard.log"),
+	}
+	s.Pid, s.Running = childAlreadyRunning(s.PidFile)
+	if !s.Running {
+		s.Pid = 0
+	}
+	return s
+}
+
+func (s daemonState) String() string {
+	if !s.Running {
+		return "not running"
+	}
+	return fmt.Sprintf("running, pid %v, log %v", s.Pid, s.LogFile)
+}
+
+// startAction forks the daemon, which runs index and backup of the originals on the schedule until stopped.
+func startAction(ctx *cli.Context) error {
+	conf, err := newConfig(ctx)
+	if err != nil {
+		return err
+	}
+	opt, err := newIndexOptions(ctx, conf)
+	if err != nil {
+		return err
+	}
+	var paths []string
+	for _, arg := range ctx.Args() {
+		if p := originalsPath(arg); p != "" {
+			paths = append(paths, p)
+		}
+	}
+	if len(paths) == 0 {
+		return cli.NewExitError("start: originals subfolder is a must", 2)
+	}
+
+	state := newDaemonState(opt.CachePath)
+	if state.Running {
+		return cli.NewExitError(fmt.Sprintf("start: already running as pid %v", state.Pid), 1)
+	}
+	if err := os.MkdirAll(opt.CachePath, 0755); err != nil {
+		return cli.NewExitError(err.Error(), 2)
+	}
+
+	cwd, _ := os.Getwd()
+	dctx := &daemon.Context{
+		PidFileName: state.PidFile,
+		PidFilePerm: 0644,
+		LogFileName: state.LogFile,
+		LogFilePerm: 0640,
+		WorkDir:     cwd,
+		Umask:       027,
+	}
+	child, err := dctx.Reborn()
+	if err == daemon.ErrWouldBlock {
+		return cli.NewExitError("start: already running", 1)
+	} else if err != nil {
+		return cli.NewExitError(fmt.Sprintf("start: %v", err), 2)
+	}
+	if child != nil {
+		fmt.Printf("started daemon, pid %v, log %v, schedule %q\n", child.Pid, state.LogFile, conf.DaemonSchedule())
+		return nil
+	}
+	defer dctx.Release()
+
+	runDaemon(*opt, paths, conf.DaemonSchedule(), ctx.Duration("wait"))
+	return nil
+}
+
+// runDaemon indexes and backs up each of paths on the schedule, until SIGTERM or ctrl+c,
+// which cancels the run going on. a run is skipped if another process holds the cache or backup for longer than wait.
+func runDaemon(opt backyard.IndexOptions, paths []string, schedule *config.Schedule, wait time.Duration) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGTERM, os.Interrupt)
+	defer signal.Stop(sig)
+
+	stopping := make(chan struct{})
+	go func() {
+		s := <-sig
+		log.Infof("daemon: got %v, stopping", s)
+		close(stopping)
+		mutex.MainWorker.Cancel()
+	}()
+
+	log.Infof("daemon: started, pid %v, schedule %q, originals %v", os.Getpid(), schedule, paths)
+	for {
+		next := schedule.Next(time.Now())
+		if next.IsZero() {
+			log.Errorf("daemon: schedule %q never runs", schedule)
+			return
+		}
+		log.Infof("daemon: next run at %v", next)
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-stopping:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		for _, p := range paths {
+			select {
+			case <-stopping:
+				return
+			default:
+			}
+			unlock, err := lockPaths(wait, opt.CachePath, opt.BackupPath)
+			if err != nil {
+				log.Errorf("daemon: run of %v skipped - %v", p, err)
+				continue
+			}
+			start := time.Now()
+			o := opt
+			o.Path = p
+			service.Index().Start(o)
+			unlock()
+			log.Infof("daemon: run of %v done in %v", p, time.Since(start))
+		}
+	}
+}
+
+// stopAction sends SIGTERM to the daemon, and waits for it to exit.
+func stopAction(ctx *cli.Context) error {
+	conf, err := newConfig(ctx)
+	if err != nil {
+		return err
+	}
+	state := newDaemonState(conf.CachePath(ctx.String("backup")))
+	if !state.Running {
+		return cli.NewExitError("stop: not running", 1)
+	}
+
+	process, err := os.FindProcess(state.Pid)
+	if err == nil {
+		err = process.Signal(syscall.SIGTERM)
+	}
+	if err != nil {
+		return cli.NewExitError(fmt.Sprintf("stop: pid %v - %v", state.Pid, err), 2)
+	}
+
+	deadline := time.Now().Add(ctx.Duration("timeout"))
+	for time.Now().Before(deadline) {
+		if _, running := childAlreadyRunning(state.PidFile); !running {
+			fmt.Printf("stopped daemon, pid %v\n", state.Pid)
+			return nil
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+	return cli.NewExitError(fmt.Sprintf("stop: pid %v still running, see %v", state.Pid, state.LogFile), 1)
+}
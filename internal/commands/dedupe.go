@@ -0,0 +1,111 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/urfave/cli"
+
+	"github.com/njhsi/8ackyard/internal/backyard"
+)
+
+// DedupeCommand registers the dedupe cli command.
+var DedupeCommand = cli.Command{
+	Name:      "dedupe",
+	Usage:     "Replaces extra copies of dupes in the originals by hardlinks, or moves them to a trash dir, if backed up",
+	ArgsUsage: "[originals path prefix]",
+	Flags:     dedupeFlags,
+	Action:    dedupeAction,
+}
+
+var dedupeFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:  "backup, b",
+		Usage: "backup path, to find the cache in",
+		Value: "",
+	},
+	cli.StringFlag{
+		Name:  "cache, s",
+		Usage: "cache path",
+		Value: "",
+	},
+	cli.BoolFlag{
+		Name:  "hardlink",
+		Usage: "replace extra copies by hardlinks of the kept one",
+	},
+	cli.StringFlag{
+		Name:  "trash",
+		Usage: "move extra copies into `DIR`, under their full path",
+		Value: "",
+	},
+	cli.BoolFlag{
+		Name:  "dry-run, n",
+		Usage: "only print what would be done",
+	},
+	cli.BoolFlag{
+		Name:  "json, j",
+		Usage: "print as json lines",
+	},
+	waitFlag,
+}
+
+// dedupeAction dedupes the originals of this host
+func dedupeAction(ctx *cli.Context) error {
+	conf, err := newConfig(ctx)
+	if err != nil {
+		return err
+	}
+
+	opt := backyard.DedupeOptions{
+		CachePath: conf.CachePath(ctx.String("backup")),
+		Prefix:    absPrefix(ctx.Args().First()),
+		TrashPath: ctx.String("trash"),
+		DryRun:    ctx.Bool("dry-run"),
+	}
+	switch {
+	case ctx.Bool("hardlink") && opt.TrashPath == "":
+		opt.Mode = backyard.DedupeHardlink
+	case !ctx.Bool("hardlink") && opt.TrashPath != "":
+		opt.Mode = backyard.DedupeTrash
+	default:
+		return cli.NewExitError("dedupe: either --hardlink or --trash DIR", 2)
+	}
+
+	if !opt.DryRun {
+		unlock, err := lockPaths(ctx.Duration("wait"), opt.CachePath, "")
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+		defer unlock()
+	}
+
+	results, err := backyard.Dedupe(opt)
+	enc := json.NewEncoder(os.Stdout)
+	failed := 0
+	for _, r := range results {
+		if r.Action != "skip" && r.Reason != "" {
+			failed++
+		}
+		if ctx.Bool("json") {
+			enc.Encode(r)
+			continue
+		}
+		line := fmt.Sprintf("%-8v %v", r.Action, r.Name)
+		if r.Dest != "" {
+			line += " -> " + r.Dest
+		}
+		if r.Reason != "" {
+			line += " (" + r.Reason + ")"
+		}
+		fmt.Println(line)
+	}
+	if err != nil {
+		return cli.NewExitError(err.Error(), 2)
+	}
+	if failed > 0 {
+		return cli.NewExitError(fmt.Sprintf("dedupe: %d files failed", failed), 1)
+	}
+
+	return nil
+}
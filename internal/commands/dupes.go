@@ -0,0 +1,89 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+	"github.com/urfave/cli"
+
+	"github.com/njhsi/8ackyard/internal/backyard"
+)
+
+// DupesCommand registers the dupes cli command.
+var DupesCommand = cli.Command{
+	Name:      "dupes",
+	Usage:     "Lists indexed originals with the same content, and bytes reclaimable by dedupe",
+	ArgsUsage: "[originals path prefix]",
+	Flags:     dupesFlags,
+	Action:    dupesAction,
+}
+
+var dupesFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:  "backup, b",
+		Usage: "backup path, to find the cache in",
+		Value: "",
+	},
+	cli.StringFlag{
+		Name:  "cache, s",
+		Usage: "cache path",
+		Value: "",
+	},
+	cli.StringFlag{
+		Name:  "host",
+		Usage: "dupes of which host, this host by default",
+		Value: "",
+	},
+	cli.BoolFlag{
+		Name:  "json, j",
+		Usage: "list as json lines",
+	},
+}
+
+// dupesAction lists groups of duplicates, the name to keep first
+func dupesAction(ctx *cli.Context) error {
+	conf, err := newConfig(ctx)
+	if err != nil {
+		return err
+	}
+
+	groups, err := backyard.Dupes(conf.CachePath(ctx.String("backup")), ctx.String("host"), absPrefix(ctx.Args().First()))
+	if err != nil {
+		return cli.NewExitError(err.Error(), 2)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	var total int64
+	for _, g := range groups {
+		total += g.Reclaimable
+		if ctx.Bool("json") {
+			enc.Encode(g)
+			continue
+		}
+		fmt.Printf("%v %v x%d, reclaimable %v, backup %v\n", backyard.Int64ToString(g.Id), humanize.IBytes(uint64(g.Size)),
+			len(g.Extra)+1, humanize.IBytes(uint64(g.Reclaimable)), orNone(g.Backup))
+		fmt.Printf("  keep %v\n", g.Keep)
+		for _, name := range g.Extra {
+			fmt.Printf("       %v\n", name)
+		}
+	}
+	if !ctx.Bool("json") {
+		fmt.Printf("%d groups, reclaimable %v\n", len(groups), humanize.IBytes(uint64(total)))
+	}
+
+	return nil
+}
+
+// absPrefix returns an originals path prefix as absolute, relative to the working dir.
+func absPrefix(prefix string) string {
+	prefix = strings.TrimSpace(prefix)
+	if prefix != "" && !strings.HasPrefix(prefix, "/") {
+		cwd, _ := os.Getwd()
+		prefix = path.Join(cwd, prefix)
+	}
+	return prefix
+}
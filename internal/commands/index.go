@@ -1,21 +1,20 @@
 package commands
 
 import (
-	"context"
+	"fmt"
 	"os"
-	"os/signal"
 	"path"
 	"strings"
 	"time"
 
+	"github.com/dustin/go-humanize"
 	"github.com/dustin/go-humanize/english"
 
 	"github.com/urfave/cli"
 
 	"github.com/njhsi/8ackyard/internal/backyard"
-	"github.com/njhsi/8ackyard/internal/mutex"
+	"github.com/njhsi/8ackyard/internal/config"
 	"github.com/njhsi/8ackyard/internal/service"
-	"github.com/photoprism/photoprism/pkg/fs"
 )
 
 // IndexCommand registers the index cli command.
@@ -34,7 +33,11 @@ var indexFlags = []cli.Flag{
 	},
 	cli.BoolFlag{
 		Name:  "cleanup, c",
-		Usage: "remove orphan index entries and thumbnails",
+		Usage: "remove orphan index entries",
+	},
+	cli.BoolFlag{
+		Name:  "takeout, t",
+		Usage: "pair media with json of Google Takeout, for time taken, geo and albums; with --force for files indexed already",
 	},
 	cli.StringFlag{
 		Name:  "backup, b",
@@ -51,77 +54,153 @@ var indexFlags = []cli.Flag{
 		Usage: "number of workers",
 		Value: 4,
 	},
+	cli.BoolFlag{
+		Name:  "dry-run",
+		Usage: "print the plan of backup, indexing into a copy of the db, not touching the backup or cache",
+	},
+	cli.BoolFlag{
+		Name:  "no-hash",
+		Usage: "with --dry-run, plan from stat only, not reading contents; backups of the same size are taken as same",
+	},
+	waitFlag,
 }
 
 // indexAction indexes all photos in originals directory (photo library)
 func indexAction(ctx *cli.Context) error {
 	// handle ctrl+c
-	contxt, cancel := context.WithCancel(context.Background())
-	signalChan := make(chan os.Signal, 1)
-	signal.Notify(signalChan, os.Interrupt)
-	defer func() {
-		signal.Stop(signalChan)
-		cancel()
-	}()
-	go func() {
-		select {
-		case <-signalChan: // first signal, cancel context
-			mutex.MainWorker.Cancel()
-			//			cancel()
-		case <-contxt.Done():
-		}
-		<-signalChan // second signal, hard exit
-		os.Exit(2)
-	}()
+	stop := cancelOnInterrupt()
+	defer stop()
 
 	// starting mainly
 	start := time.Now()
 
-	backupPath := ctx.String("backup")
-	cachePath := ctx.String("cache")
-	if cachePath == "" && backupPath != "" {
-		cachePath = backupPath + "/.cache8"
+	conf, err := newConfig(ctx)
+	if err != nil {
+		return err
 	}
-	if cachePath == "" {
-		cachePath = "/tmp/cache8/"
+	opt, err := newIndexOptions(ctx, conf)
+	if err != nil {
+		return err
 	}
-	numWorkers := ctx.Int("workers")
-
-	// Use first argument to limit scope if set.
-	subPath := strings.TrimSpace(ctx.Args().First())
-	if subPath == "" {
-		log.Errorf("indexing not going as subpath is not provided, but it's a must for originals=%s", subPath)
+	if opt.Path == "" {
+		log.Errorf("indexing not going as subpath is not provided, but it's a must for originals")
 		return nil
+	}
+	if ctx.Bool("no-hash") && !ctx.Bool("dry-run") {
+		return cli.NewExitError("index: --no-hash is only for --dry-run", 2)
+	}
+	if ctx.Bool("dry-run") { // on a consistent copy of the db, no lock taken
+		opt.Plan = backyard.NewPlan()
+		opt.Plan.NoHash = ctx.Bool("no-hash")
 	} else {
-		if strings.HasPrefix(subPath, "/") || strings.HasPrefix(subPath, "~") {
-
-		} else {
-			cwd, _ := os.Getwd()
-			subPath = path.Join(cwd, subPath)
+		unlock, err := lockPaths(ctx.Duration("wait"), opt.CachePath, opt.BackupPath)
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
 		}
-		subPath = path.Clean(subPath)
-		log.Infof("indexing originals= %s, backup=%s, cache=%s, n=%d", subPath, backupPath, cachePath, numWorkers)
+		defer unlock()
 	}
 
-	var indexed fs.Done
+	var indexed int
+	var cleaned []string
+	if opt.Cleanup {
+		opt.Cleaned = &cleaned
+	}
 
 	if w := service.Index(); w != nil {
-		opt := backyard.IndexOptions{
-			Path:       subPath,
-			BackupPath: backupPath,
-			CachePath:  cachePath,
-			NumWorkers: numWorkers,
-			Rescan:     true,
-			Convert:    false,
-			Stack:      true,
-		}
-
-		indexed = w.Start(opt)
+		indexed = w.Start(*opt)
 	}
 
 	elapsed := time.Since(start)
 
-	log.Infof("indexed %s in %s", english.Plural(len(indexed), "file", "files"), elapsed)
+	log.Infof("indexed %s in %s", english.Plural(indexed, "file", "files"), elapsed)
 
+	if opt.Cleanup {
+		for _, name := range cleaned {
+			fmt.Printf("removed %v\n", name)
+		}
+		fmt.Printf("cleanup removed %v of files gone\n", english.Plural(len(cleaned), "index entry", "index entries"))
+	}
+
+	if opt.Plan != nil {
+		printPlan(opt.Plan)
+	}
 	return nil
 }
+
+// printPlan prints the actions planned by a dry run, and their totals.
+func printPlan(plan *backyard.Plan) {
+	for _, e := range plan.Entries {
+		switch e.Action {
+		case backyard.PlanCopy, backyard.PlanRename:
+			fmt.Printf("%-8v %v -> %v, %v\n", e.Action, e.Name, e.Dest, humanize.IBytes(uint64(e.Size)))
+		default:
+			fmt.Printf("%-8v %v, %v\n", e.Action, e.Name, e.Reason)
+		}
+	}
+	fmt.Printf("%v of %v to copy, %v, %v skipped, %v, %v in place\n",
+		english.Plural(plan.Count(backyard.PlanCopy), "file", "files"), humanize.IBytes(uint64(plan.CopyBytes())),
+		english.Plural(plan.Count(backyard.PlanRename), "rename", "renames"), plan.Count(backyard.PlanSkip),
+		english.Plural(plan.Count(backyard.PlanConflict), "conflict", "conflicts"), plan.Kept)
+}
+
+// newIndexOptions returns options of indexing the originals subfolder in the first argument, as configured.
+// Path is empty if not given.
+func newIndexOptions(ctx *cli.Context, conf *config.Config) (*backyard.IndexOptions, error) {
+	timeZones, err := newTimeZones(conf)
+	if err != nil {
+		return nil, err
+	}
+	layout, documentsLayout, err := newLayouts(conf)
+	if err != nil {
+		return nil, err
+	}
+	altNames, err := backyard.ParseLinkMode(conf.AltNames)
+	if err != nil {
+		return nil, err
+	}
+
+	backupPath := ctx.String("backup")
+	cachePath := conf.CachePath(backupPath)
+	numWorkers := conf.Workers
+
+	// Use first argument to limit scope if set.
+	subPath := originalsPath(ctx.Args().First())
+	if subPath != "" {
+		log.Infof("indexing originals= %s, backup=%s, cache=%s, n=%d", subPath, backupPath, cachePath, numWorkers)
+	}
+
+	return &backyard.IndexOptions{
+		Path:            subPath,
+		BackupPath:      backupPath,
+		CachePath:       cachePath,
+		TimeZones:       timeZones,
+		SizeLimit:       conf.OriginalsLimit(),
+		Layout:          layout,
+		Sidecars:        backyard.NewSidecars(conf.Sidecars),
+		Documents:       conf.Documents,
+		DocumentsLayout: documentsLayout,
+		AltNames:        altNames,
+		NumWorkers:      numWorkers,
+		Force:           ctx.Bool("force"),
+		Cleanup:         ctx.Bool("cleanup"),
+		Takeout:         ctx.Bool("takeout"),
+		Rescan:          true,
+		Convert:         false,
+		Stack:           true,
+	}, nil
+}
+
+// originalsPath returns the originals subfolder given, absolute by the working dir, empty if not given.
+func originalsPath(arg string) string {
+	subPath := strings.TrimSpace(arg)
+	if subPath == "" {
+		return ""
+	}
+	if strings.HasPrefix(subPath, "/") || strings.HasPrefix(subPath, "~") {
+
+	} else {
+		cwd, _ := os.Getwd()
+		subPath = path.Join(cwd, subPath)
+	}
+	return path.Clean(subPath)
+}
@@ -0,0 +1,97 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/urfave/cli"
+
+	"github.com/njhsi/8ackyard/internal/backyard"
+)
+
+// QueryCommand registers the query cli command.
+var QueryCommand = cli.Command{
+	Name:    "query",
+	Aliases: []string{"find"},
+	Usage:   "Finds indexed files by a filter, like: mime:video born:2019-06..2019-08 host:nas size:>1G camera:\"iPhone 12\"",
+	Description: `Terms are and-ed, a term prefixed by - is negated, a bare word matches the file name.
+   name:IMG_*.JPG  ext:heic  mime:image/jpeg  host:nas  id:9c3a0e5f4b1d2e77  src:meta|name|stat|takeout
+   born:2019  born:2019-06..2019-08  born:>=2020-01-01  size:>1G  size:100K..2M
+   camera:X-T3  lens:35mm  duration:>10m  album:Holidays  backup:yes|no`,
+	ArgsUsage: "[terms]",
+	Flags:     queryFlags,
+	Action:    queryAction,
+}
+
+var queryFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:  "backup, b",
+		Usage: "backup path, to find the cache in",
+		Value: "",
+	},
+	cli.StringFlag{
+		Name:  "cache, s",
+		Usage: "cache path",
+		Value: "",
+	},
+	cli.StringFlag{
+		Name:  "print, p",
+		Usage: "what to print of each file: name, backup or both",
+		Value: "name",
+	},
+	cli.BoolFlag{
+		Name:  "json, j",
+		Usage: "print as json lines, with metadata",
+	},
+	cli.IntFlag{
+		Name:  "limit, l",
+		Usage: "print at most this many files, all if 0",
+	},
+}
+
+// queryAction prints indexed files matching the terms
+func queryAction(ctx *cli.Context) error {
+	conf, err := newConfig(ctx)
+	if err != nil {
+		return err
+	}
+	timeZones, err := newTimeZones(conf)
+	if err != nil {
+		return err
+	}
+	cachePath := conf.CachePath(ctx.String("backup"))
+
+	show := ctx.String("print")
+	if show != "name" && show != "backup" && show != "both" {
+		return cli.NewExitError(fmt.Sprintf("query: --print %q, name, backup or both expected", show), 2)
+	}
+
+	q, err := backyard.ParseQuery(strings.Join(ctx.Args(), " "), timeZones.Default)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 2)
+	}
+	results, err := q.Find(cachePath, ctx.Int("limit"))
+	if err != nil {
+		return cli.NewExitError(err.Error(), 2)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	for _, r := range results {
+		switch {
+		case ctx.Bool("json"):
+			enc.Encode(r)
+		case show == "backup":
+			if r.Backup != "" {
+				fmt.Println(r.Backup)
+			}
+		case show == "both":
+			fmt.Printf("%v\t%v\n", r.Name, r.Backup)
+		default:
+			fmt.Println(r.Name)
+		}
+	}
+
+	return nil
+}
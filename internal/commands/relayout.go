@@ -0,0 +1,75 @@
+package commands
+
+import (
+	"errors"
+	"time"
+
+	"github.com/dustin/go-humanize/english"
+	"github.com/urfave/cli"
+
+	"github.com/njhsi/8ackyard/internal/backyard"
+)
+
+// RelayoutCommand registers the relayout cli command.
+var RelayoutCommand = cli.Command{
+	Name:   "relayout",
+	Usage:  "Moves existing backup files to where the layout puts them",
+	Flags:  relayoutFlags,
+	Action: relayoutAction,
+}
+
+var relayoutFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:  "backup, b",
+		Usage: "backup path",
+		Value: "",
+	},
+	cli.StringFlag{
+		Name:  "cache, s",
+		Usage: "cache path",
+		Value: "",
+	},
+	waitFlag,
+}
+
+// relayoutAction moves backup files by the configured layout
+func relayoutAction(ctx *cli.Context) error {
+	stop := cancelOnInterrupt()
+	defer stop()
+
+	start := time.Now()
+
+	conf, err := newConfig(ctx)
+	if err != nil {
+		return err
+	}
+
+	backupPath := ctx.String("backup")
+	if backupPath == "" {
+		return errors.New("relayout: backup path is a must")
+	}
+
+	layout, documentsLayout, err := newLayouts(conf)
+	if err != nil {
+		return err
+	}
+
+	unlock, err := lockPaths(ctx.Duration("wait"), conf.CachePath(backupPath), backupPath)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	defer unlock()
+
+	opt := backyard.RelayoutOptions{
+		BackupPath:      backupPath,
+		CachePath:       conf.CachePath(backupPath),
+		Layout:          layout,
+		DocumentsLayout: documentsLayout,
+	}
+
+	moved, err := backyard.Relayout(opt)
+
+	log.Infof("relayout moved %s in %s", english.Plural(moved, "file", "files"), time.Since(start))
+
+	return err
+}
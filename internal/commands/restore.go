@@ -0,0 +1,129 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/dustin/go-humanize/english"
+	"github.com/urfave/cli"
+
+	"github.com/njhsi/8ackyard/internal/backyard"
+)
+
+// RestoreCommand registers the restore cli command.
+var RestoreCommand = cli.Command{
+	Name:      "restore",
+	Usage:     "Restores backup files to their original paths, or under a target folder",
+	ArgsUsage: "[originals path prefix]",
+	Flags:     restoreFlags,
+	Action:    restoreAction,
+}
+
+var restoreFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:  "backup, b",
+		Usage: "backup path, to find the cache in",
+		Value: "",
+	},
+	cli.StringFlag{
+		Name:  "cache, s",
+		Usage: "cache path",
+		Value: "",
+	},
+	cli.StringFlag{
+		Name:  "host",
+		Usage: "restore originals of which host, this host by default",
+		Value: "",
+	},
+	cli.StringFlag{
+		Name:  "since",
+		Usage: "only files born since `DATE` (2006-01-02)",
+		Value: "",
+	},
+	cli.StringFlag{
+		Name:  "until",
+		Usage: "only files born before `DATE` (2006-01-02)",
+		Value: "",
+	},
+	cli.StringFlag{
+		Name:  "target, t",
+		Usage: "restore under target folder, instead of the original paths",
+		Value: "",
+	},
+	cli.BoolFlag{
+		Name:  "overwrite",
+		Usage: "overwrite existing files with different content",
+	},
+	cli.IntFlag{
+		Name:  "workers, n",
+		Usage: "number of workers",
+		Value: 4,
+	},
+}
+
+// restoreAction copies backup files of a host back to the original layout
+func restoreAction(ctx *cli.Context) error {
+	stop := cancelOnInterrupt()
+	defer stop()
+
+	start := time.Now()
+
+	conf, err := newConfig(ctx)
+	if err != nil {
+		return err
+	}
+
+	opt := backyard.RestoreOptions{
+		CachePath:  conf.CachePath(ctx.String("backup")),
+		Hostname:   ctx.String("host"),
+		Prefix:     strings.TrimSpace(ctx.Args().First()),
+		Target:     ctx.String("target"),
+		NumWorkers: conf.Workers,
+		Overwrite:  ctx.Bool("overwrite"),
+	}
+
+	if opt.Prefix != "" && !strings.HasPrefix(opt.Prefix, "/") {
+		cwd, _ := os.Getwd()
+		opt.Prefix = path.Join(cwd, opt.Prefix)
+	}
+
+	if opt.Since, err = parseDate(ctx.String("since")); err != nil {
+		return err
+	}
+	if opt.Until, err = parseDate(ctx.String("until")); err != nil {
+		return err
+	}
+
+	log.Infof("restoring host=%s, prefix=%s, since=%v, until=%v, target=%s", opt.Hostname, opt.Prefix, opt.Since, opt.Until, opt.Target)
+
+	summary, err := backyard.Restore(opt)
+
+	log.Infof("restored %s (%s) in %s, %v", english.Plural(summary.Status[backyard.RestoreDone], "file", "files"),
+		humanize.Bytes(uint64(summary.Bytes)), time.Since(start), summary.Status)
+
+	if err != nil {
+		return cli.NewExitError(err.Error(), 2)
+	}
+	if n := summary.Status[backyard.RestoreFailed] + summary.Status[backyard.RestoreConflict]; n > 0 {
+		return cli.NewExitError(fmt.Sprintf("restore: %d files not restored", n), 1)
+	}
+
+	return nil
+}
+
+// parseDate parses a local date like 2006-01-02, returns zero time for an empty string.
+func parseDate(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", s, time.Local)
+	if err != nil {
+		return t, errors.New("invalid date " + s + ", expected like 2006-01-02")
+	}
+	return t, nil
+}
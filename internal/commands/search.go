@@ -0,0 +1,73 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/urfave/cli"
+
+	"github.com/njhsi/8ackyard/internal/backyard"
+)
+
+// SearchCommand registers the search cli command.
+var SearchCommand = cli.Command{
+	Name:      "search",
+	Usage:     "Searches titles, descriptions, subjects, keywords, notes and artists of indexed files, best matches first",
+	ArgsUsage: "[fts5 query, like \"birthday cake\", birth* or hdr OR panorama]",
+	Flags:     searchFlags,
+	Action:    searchAction,
+}
+
+var searchFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:  "backup, b",
+		Usage: "backup path, to find the cache in",
+		Value: "",
+	},
+	cli.StringFlag{
+		Name:  "cache, s",
+		Usage: "cache path",
+		Value: "",
+	},
+	cli.BoolFlag{
+		Name:  "json, j",
+		Usage: "print as json lines, with metadata",
+	},
+	cli.IntFlag{
+		Name:  "limit, l",
+		Usage: "print at most this many files, all if 0",
+		Value: 50,
+	},
+}
+
+// searchAction prints indexed files matching the text, with their backup paths
+func searchAction(ctx *cli.Context) error {
+	conf, err := newConfig(ctx)
+	if err != nil {
+		return err
+	}
+	cachePath := conf.CachePath(ctx.String("backup"))
+
+	text := strings.TrimSpace(strings.Join(ctx.Args(), " "))
+	if text == "" {
+		return cli.NewExitError("search: text to search is a must", 2)
+	}
+
+	results, err := backyard.Search(cachePath, text, ctx.Int("limit"))
+	if err != nil {
+		return cli.NewExitError(err.Error(), 2)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	for _, r := range results {
+		if ctx.Bool("json") {
+			enc.Encode(r)
+			continue
+		}
+		fmt.Printf("%v\t%v\n", r.Name, r.Backup)
+	}
+
+	return nil
+}
@@ -0,0 +1,117 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+	"github.com/urfave/cli"
+
+	"github.com/njhsi/8ackyard/internal/backyard"
+)
+
+// StatusCommand registers the status cli command.
+var StatusCommand = cli.Command{
+	Name:   "status",
+	Usage:  "Shows whether the daemon is running, and statistics of the catalog, overall and per host",
+	Flags:  statusFlags,
+	Action: statusAction,
+}
+
+var statusFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:  "backup, b",
+		Usage: "backup path, to find the cache in",
+		Value: "",
+	},
+	cli.StringFlag{
+		Name:  "cache, s",
+		Usage: "cache path",
+		Value: "",
+	},
+	cli.BoolFlag{
+		Name:  "json, j",
+		Usage: "print as json",
+	},
+}
+
+// statusAction prints the daemon state and statistics of the catalog
+func statusAction(ctx *cli.Context) error {
+	conf, err := newConfig(ctx)
+	if err != nil {
+		return err
+	}
+	cachePath := conf.CachePath(ctx.String("backup"))
+
+	status, err := backyard.CatalogStatus(cachePath)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 2)
+	}
+
+	daemon := newDaemonState(cachePath)
+
+	if ctx.Bool("json") {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(struct {
+			*backyard.Status
+			Daemon daemonState `json:"daemon"`
+		}{status, daemon})
+	}
+
+	fmt.Printf("daemon: %v\n", daemon)
+	fmt.Printf("catalog %v, schema version %v\n", backyard.DbName(cachePath), status.SchemaVersion)
+	printHostStatus("overall", status.Overall)
+	for _, h := range status.Hosts {
+		printHostStatus("host "+h.Hostname, h)
+	}
+	b := status.Backup
+	fmt.Printf("backup: %v, orphaned %v, unresolved conflicts %v\n", countString(b.Count), countString(b.Orphaned), b.Conflicts)
+
+	return nil
+}
+
+func printHostStatus(title string, h backyard.HostStatus) {
+	fmt.Printf("%v: %v, %v distinct, duplicates %.1f%%, not backed up %v\n",
+		title, countString(h.Count), h.Ids, h.DuplicateRatio*100, countString(h.NotBackedUp))
+
+	var mimes []string
+	for _, k := range sortedKeys(h.ByMIME) {
+		mimes = append(mimes, fmt.Sprintf("%v %v", orNone(k), countString(h.ByMIME[k])))
+	}
+	fmt.Printf("  mime:  %v\n", strings.Join(mimes, ", "))
+	fmt.Printf("  birth: %v\n", joinCounts(h.ByTimeBornSrc))
+	fmt.Printf("  years: %v\n", joinCounts(h.ByYear))
+}
+
+func countString(c backyard.Count) string {
+	return fmt.Sprintf("%v files %v", c.Files, humanize.IBytes(uint64(c.Bytes)))
+}
+
+func joinCounts(counts map[string]int64) string {
+	var s []string
+	for _, k := range sortedKeys(counts) {
+		s = append(s, fmt.Sprintf("%v %v", orNone(k), counts[k]))
+	}
+	return strings.Join(s, ", ")
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// sortedKeys returns keys of m, sorted.
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
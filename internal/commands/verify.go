@@ -0,0 +1,79 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/urfave/cli"
+
+	"github.com/njhsi/8ackyard/internal/backyard"
+)
+
+// VerifyCommand registers the verify cli command.
+var VerifyCommand = cli.Command{
+	Name:   "verify",
+	Usage:  "Verifies integrity of backup files, reports as json lines",
+	Flags:  verifyFlags,
+	Action: verifyAction,
+}
+
+var verifyFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:  "backup, b",
+		Usage: "backup path, to find the cache in",
+		Value: "",
+	},
+	cli.StringFlag{
+		Name:  "cache, s",
+		Usage: "cache path",
+		Value: "",
+	},
+	cli.IntFlag{
+		Name:  "workers, n",
+		Usage: "number of workers",
+		Value: 4,
+	},
+	cli.BoolFlag{
+		Name:  "all, a",
+		Usage: "report healthy files too, not only the damaged and changed",
+	},
+}
+
+// verifyAction re-hashes all backup files in filez, exits with 1 on damage
+func verifyAction(ctx *cli.Context) error {
+	stop := cancelOnInterrupt()
+	defer stop()
+
+	start := time.Now()
+
+	conf, err := newConfig(ctx)
+	if err != nil {
+		return err
+	}
+
+	opt := backyard.VerifyOptions{
+		CachePath:  conf.CachePath(ctx.String("backup")),
+		NumWorkers: conf.Workers,
+	}
+	reportAll := ctx.Bool("all")
+
+	enc := json.NewEncoder(os.Stdout)
+	summary, err := backyard.Verify(opt, func(r *backyard.VerifyReport) {
+		if reportAll || r.Status != backyard.VerifyOk {
+			enc.Encode(r)
+		}
+	})
+
+	log.Infof("verified %d backup files in %s", summary.Checked, time.Since(start))
+
+	if err != nil {
+		return cli.NewExitError(err.Error(), 2)
+	}
+	if summary.Damaged > 0 {
+		return cli.NewExitError(fmt.Sprintf("verify: %d damaged backup files", summary.Damaged), 1)
+	}
+
+	return nil
+}
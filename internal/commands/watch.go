@@ -0,0 +1,96 @@
+package commands
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/urfave/cli"
+
+	"github.com/njhsi/8ackyard/internal/backyard"
+	"github.com/njhsi/8ackyard/internal/mutex"
+	"github.com/njhsi/8ackyard/internal/service"
+)
+
+// WatchCommand registers the watch cli command.
+var WatchCommand = cli.Command{
+	Name:      "watch",
+	Usage:     "Indexes originals once, then keeps indexing files as they are created, changed or removed",
+	ArgsUsage: "[originals subfolder]",
+	Flags:     watchFlags,
+	Action:    watchAction,
+}
+
+var watchFlags = []cli.Flag{
+	cli.BoolFlag{
+		Name:  "cleanup, c",
+		Usage: "remove orphan index entries in the first pass too; those of removed files always go",
+	},
+	cli.BoolFlag{
+		Name:  "takeout, t",
+		Usage: "pair media with json of Google Takeout, for time taken, geo and albums",
+	},
+	cli.StringFlag{
+		Name:  "backup, b",
+		Usage: "backup to where, after the first pass and as files are indexed",
+		Value: "",
+	},
+	cli.BoolFlag{
+		Name:  "backup-once",
+		Usage: "back up in the first pass only, not files indexed while watching",
+	},
+	cli.StringFlag{
+		Name:  "cache, s",
+		Usage: "cache path",
+		Value: "",
+	},
+	cli.IntFlag{
+		Name:  "workers, n",
+		Usage: "number of workers",
+		Value: 4,
+	},
+	cli.DurationFlag{
+		Name:  "settle",
+		Usage: "how long a file must be left unchanged before indexed",
+		Value: backyard.DefaultWatchSettle,
+	},
+	waitFlag,
+}
+
+// watchAction indexes the originals, then watches them by inotify until interrupted.
+func watchAction(ctx *cli.Context) error {
+	conf, err := newConfig(ctx)
+	if err != nil {
+		return err
+	}
+	opt, err := newIndexOptions(ctx, conf)
+	if err != nil {
+		return err
+	}
+	if opt.Path == "" {
+		return cli.NewExitError("watch: originals subfolder is a must", 2)
+	}
+
+	contxt, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-contxt.Done()
+		mutex.MainWorker.Cancel() // of the pass running, if any
+	}()
+
+	err = service.Index().Watch(contxt, backyard.WatchOptions{
+		IndexOptions: *opt,
+		Settle:       ctx.Duration("settle"),
+		Backup:       !ctx.Bool("backup-once"),
+		Lock: func() (func(), error) {
+			return lockPaths(ctx.Duration("wait"), opt.CachePath, opt.BackupPath)
+		},
+	})
+	if err != nil {
+		return cli.NewExitError(err.Error(), 2)
+	}
+
+	log.Infof("watch: stopped")
+	return nil
+}
@@ -1,12 +1,200 @@
 package config
 
-var CacheDir = "/tmp/cache8/"
-var FileRoot = "/"
+import (
+	"errors"
+	"fmt"
+	iofs "io/fs"
+	"os"
+	"path/filepath"
+	"strings"
 
-func CachePath() string {
-	return CacheDir
+	"github.com/dustin/go-humanize"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+	"gopkg.in/yaml.v2"
+
+	"github.com/njhsi/8ackyard/internal/event"
+)
+
+// Config holds the settings of 8ackyard. Precedence from low to high:
+// defaults, config file, environment variables, flags.
+type Config struct {
+	CacheDir      string `yaml:"cache"`          // empty for a folder in the backup path
+	LogLevel      string `yaml:"log-level"`      // panic, fatal, error, warn, info, debug, trace
+	TimeZone      string `yaml:"timezone"`       // of files without zone info
+	TimeZoneRules string `yaml:"timezone-rules"` // file of time zone rules
+	SizeLimit     string `yaml:"size-limit"`     // of originals to index, like 8GiB
+	Workers       int    `yaml:"workers"`
+	Layout        string `yaml:"layout"` // template of backup destinations
+
+	Sidecars        []string `yaml:"sidecars"`         // extensions of files following their primary media, default if nil, none if empty
+	Documents       bool     `yaml:"documents"`        // back up non-media files too
+	DocumentsLayout string   `yaml:"documents-layout"` // template of backup destinations of non-media files
+	AltNames        string   `yaml:"alt-names"`        // none, symlink or hardlink: link other names and birth folders to the backup
+
+	Schedule string `yaml:"schedule"` // cron spec of index and backup runs by the daemon, like "0 3 * * *"
+
+	sizeLimit int64
+	schedule  *Schedule
+	file      string
+}
+
+// NewConfig returns the config with defaults, the config file, environment variables and global flags applied.
+func NewConfig(ctx *cli.Context) (*Config, error) {
+	c := &Config{
+		LogLevel:  "debug",
+		TimeZone:  "Asia/Chongqing",
+		SizeLimit: "8GiB",
+		Workers:   4,
+		Documents: true,
+		Schedule:  "0 3 * * *",
+	}
+
+	c.file = ctx.GlobalString("config")
+	if c.file == "" {
+		c.file = DefaultConfigFile()
+	}
+	if err := c.load(c.file, ctx.GlobalIsSet("config")); err != nil {
+		return nil, err
+	}
+
+	if ctx.GlobalIsSet("cache") {
+		c.CacheDir = ctx.GlobalString("cache")
+	}
+	if ctx.GlobalIsSet("log-level") {
+		c.LogLevel = ctx.GlobalString("log-level")
+	}
+	if ctx.GlobalIsSet("timezone") {
+		c.TimeZone = ctx.GlobalString("timezone")
+	}
+	if ctx.GlobalIsSet("timezone-rules") {
+		c.TimeZoneRules = ctx.GlobalString("timezone-rules")
+	}
+	if ctx.GlobalIsSet("size-limit") {
+		c.SizeLimit = ctx.GlobalString("size-limit")
+	}
+	if ctx.GlobalIsSet("workers") {
+		c.Workers = ctx.GlobalInt("workers")
+	}
+	if ctx.GlobalIsSet("layout") {
+		c.Layout = ctx.GlobalString("layout")
+	}
+	if ctx.GlobalIsSet("sidecars") {
+		c.Sidecars = splitList(ctx.GlobalString("sidecars"))
+	}
+	if ctx.GlobalIsSet("documents") {
+		c.Documents = ctx.GlobalBoolT("documents")
+	}
+	if ctx.GlobalIsSet("documents-layout") {
+		c.DocumentsLayout = ctx.GlobalString("documents-layout")
+	}
+	if ctx.GlobalIsSet("alt-names") {
+		c.AltNames = ctx.GlobalString("alt-names")
+	}
+	if ctx.GlobalIsSet("schedule") {
+		c.Schedule = ctx.GlobalString("schedule")
+	}
+
+	if err := c.Init(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// splitList splits a comma separated list, empty but not nil if s is empty.
+func splitList(s string) []string {
+	list := make([]string, 0)
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// DefaultConfigFile returns the config file name in the user config folder, like ~/.config/8ackyard/config.yml
+func DefaultConfigFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "8ackyard", "config.yml")
+}
+
+// load reads the config file, which is a must only if asked explicitly.
+func (c *Config) load(fileName string, must bool) error {
+	if fileName == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(fileName)
+	if errors.Is(err, iofs.ErrNotExist) && !must {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("config: %v", err)
+	}
+
+	if err := yaml.UnmarshalStrict(data, c); err != nil {
+		return fmt.Errorf("config: %s - %v", fileName, err)
+	}
+
+	return nil
+}
+
+// Init validates the settings and applies the log level.
+func (c *Config) Init() error {
+	level, err := logrus.ParseLevel(c.LogLevel)
+	if err != nil {
+		return fmt.Errorf("config: %v", err)
+	}
+	event.Log.SetLevel(level)
+
+	size, err := humanize.ParseBytes(c.SizeLimit)
+	if err != nil {
+		return fmt.Errorf("config: size limit %v", err)
+	}
+	c.sizeLimit = int64(size)
+
+	if c.Workers <= 0 {
+		return fmt.Errorf("config: workers %d must be positive", c.Workers)
+	}
+
+	switch c.AltNames {
+	case "", "none", "symlink", "hardlink":
+	default:
+		return fmt.Errorf("config: alt-names %q must be none, symlink or hardlink", c.AltNames)
+	}
+
+	if c.schedule, err = ParseSchedule(c.Schedule); err != nil {
+		return fmt.Errorf("config: %v", err)
+	}
+
+	return nil
+}
+
+// File returns the config file name, which may not exist.
+func (c *Config) File() string {
+	return c.file
+}
+
+// CachePath returns the cache path, which defaults to a folder in the backup path.
+func (c *Config) CachePath(backupPath string) string {
+	if c.CacheDir != "" {
+		return c.CacheDir
+	}
+	if backupPath != "" {
+		return backupPath + "/.cache8"
+	}
+	return "/tmp/cache8/"
+}
+
+// OriginalsLimit returns the max size in bytes of originals to index.
+func (c *Config) OriginalsLimit() int64 {
+	return c.sizeLimit
 }
 
-func OriginalsLimit() int64 {
-	return 8 * 1024 * 1024 * 1024
+// DaemonSchedule returns when the daemon runs index and backup.
+func (c *Config) DaemonSchedule() *Schedule {
+	return c.schedule
 }
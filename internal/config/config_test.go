@@ -0,0 +1,124 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli"
+)
+
+// runConfig runs an app with the global flags and args, returning the config it got.
+func runConfig(t *testing.T, args ...string) (conf *Config, err error) {
+	app := cli.NewApp()
+	app.Flags = GlobalFlags
+	app.Action = func(ctx *cli.Context) error {
+		conf, err = NewConfig(ctx)
+		return nil
+	}
+	if err := app.Run(append([]string{"8ackyard"}, args...)); err != nil {
+		t.Fatal(err)
+	}
+	return conf, err
+}
+
+func TestNewConfig(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "config.yml")
+	err := os.WriteFile(configFile, []byte("cache: /srv/cache8\ntimezone: Europe/Berlin\nsize-limit: 1GiB\nworkers: 2\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("defaults", func(t *testing.T) {
+		t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+		conf, err := runConfig(t)
+		if assert.NoError(t, err) {
+			assert.Equal(t, "Asia/Chongqing", conf.TimeZone)
+			assert.Equal(t, int64(8*1024*1024*1024), conf.OriginalsLimit())
+			assert.Equal(t, 4, conf.Workers)
+			assert.Equal(t, "/mnt/backup/.cache8", conf.CachePath("/mnt/backup"))
+			assert.Equal(t, "/tmp/cache8/", conf.CachePath(""))
+		}
+	})
+
+	t.Run("file", func(t *testing.T) {
+		conf, err := runConfig(t, "--config", configFile)
+		if assert.NoError(t, err) {
+			assert.Equal(t, "Europe/Berlin", conf.TimeZone)
+			assert.Equal(t, int64(1024*1024*1024), conf.OriginalsLimit())
+			assert.Equal(t, 2, conf.Workers)
+			assert.Equal(t, "/srv/cache8", conf.CachePath("/mnt/backup"))
+		}
+	})
+
+	t.Run("env over file", func(t *testing.T) {
+		t.Setenv("BACKYARD_CONFIG", configFile)
+		t.Setenv("BACKYARD_WORKERS", "6")
+
+		conf, err := runConfig(t)
+		if assert.NoError(t, err) {
+			assert.Equal(t, "Europe/Berlin", conf.TimeZone)
+			assert.Equal(t, 6, conf.Workers)
+		}
+	})
+
+	t.Run("flag over env", func(t *testing.T) {
+		t.Setenv("BACKYARD_CONFIG", configFile)
+		t.Setenv("BACKYARD_TIMEZONE", "Asia/Tokyo")
+
+		conf, err := runConfig(t, "--timezone", "UTC")
+		if assert.NoError(t, err) {
+			assert.Equal(t, "UTC", conf.TimeZone)
+		}
+	})
+
+	t.Run("sidecars and documents", func(t *testing.T) {
+		t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+		conf, err := runConfig(t)
+		if assert.NoError(t, err) {
+			assert.Nil(t, conf.Sidecars)
+			assert.True(t, conf.Documents)
+		}
+
+		noneFile := filepath.Join(t.TempDir(), "none.yml")
+		if err := os.WriteFile(noneFile, []byte("sidecars: []\ndocuments: false\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		conf, err = runConfig(t, "--config", noneFile)
+		if assert.NoError(t, err) {
+			assert.Equal(t, []string{}, conf.Sidecars)
+			assert.False(t, conf.Documents)
+		}
+
+		conf, err = runConfig(t, "--config", noneFile, "--sidecars", ".aae, xmp", "--documents")
+		if assert.NoError(t, err) {
+			assert.Equal(t, []string{".aae", "xmp"}, conf.Sidecars)
+			assert.True(t, conf.Documents)
+		}
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		_, err := runConfig(t, "--config", filepath.Join(t.TempDir(), "none.yml"))
+		assert.Error(t, err)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := runConfig(t, "--size-limit", "lots")
+		assert.Error(t, err)
+
+		_, err = runConfig(t, "--alt-names", "copy")
+		assert.Error(t, err)
+
+		_, err = runConfig(t, "--schedule", "daily")
+		assert.Error(t, err)
+
+		_, err = runConfig(t, "--workers", "0")
+		assert.Error(t, err)
+
+		_, err = runConfig(t, "--log-level", "loud")
+		assert.Error(t, err)
+	})
+}
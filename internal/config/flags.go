@@ -0,0 +1,80 @@
+package config
+
+import (
+	"github.com/urfave/cli"
+)
+
+// GlobalFlags lists the flags shared by all commands, each can be set by environment variable too.
+var GlobalFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:   "config, C",
+		Usage:  "config `FILE`, ~/.config/8ackyard/config.yml by default",
+		EnvVar: "BACKYARD_CONFIG",
+	},
+	cli.StringFlag{
+		Name:   "cache",
+		Usage:  "cache `PATH`, .cache8 in the backup path by default",
+		EnvVar: "BACKYARD_CACHE",
+	},
+	cli.StringFlag{
+		Name:   "log-level, l",
+		Usage:  "log `LEVEL`: error, warn, info, debug or trace",
+		Value:  "debug",
+		EnvVar: "BACKYARD_LOG_LEVEL",
+	},
+	cli.StringFlag{
+		Name:   "timezone, z",
+		Usage:  "default time zone of files without zone info, IANA `ZONE` like Europe/Berlin or offset like +08:00",
+		Value:  "Asia/Chongqing",
+		EnvVar: "BACKYARD_TIMEZONE",
+	},
+	cli.StringFlag{
+		Name:   "timezone-rules",
+		Usage:  "`FILE` of rules mapping path globs or camera models to time zones",
+		EnvVar: "BACKYARD_TIMEZONE_RULES",
+	},
+	cli.StringFlag{
+		Name:   "size-limit",
+		Usage:  "max `SIZE` of originals to index",
+		Value:  "8GiB",
+		EnvVar: "BACKYARD_SIZE_LIMIT",
+	},
+	cli.IntFlag{
+		Name:   "workers",
+		Usage:  "number of workers",
+		Value:  4,
+		EnvVar: "BACKYARD_WORKERS",
+	},
+	cli.StringFlag{
+		Name:   "layout",
+		Usage:  "`TEMPLATE` of backup destinations, like {{.MIMEType}}/{{.Year}}/{{.Month}}-{{.CameraModel}}/{{.Basename}}",
+		EnvVar: "BACKYARD_LAYOUT",
+	},
+	cli.StringFlag{
+		Name:   "sidecars",
+		Usage:  "comma separated `EXTS` of sidecar files backed up next to their media, like .aae,.xmp,.json,.thm,.lrv by default",
+		EnvVar: "BACKYARD_SIDECARS",
+	},
+	cli.BoolTFlag{
+		Name:   "documents",
+		Usage:  "back up non-media files too, use --documents=false to ignore them",
+		EnvVar: "BACKYARD_DOCUMENTS",
+	},
+	cli.StringFlag{
+		Name:   "documents-layout",
+		Usage:  "`TEMPLATE` of backup destinations of non-media files, documents/{{.Year}}/{{.Basename}} by default",
+		EnvVar: "BACKYARD_DOCUMENTS_LAYOUT",
+	},
+	cli.StringFlag{
+		Name:   "alt-names",
+		Usage:  "`MODE` of linking other names and birth folders of a file to its backup: none, symlink or hardlink",
+		Value:  "none",
+		EnvVar: "BACKYARD_ALT_NAMES",
+	},
+	cli.StringFlag{
+		Name:   "schedule",
+		Usage:  "`CRON` spec of index and backup runs by the daemon, like \"0 3 * * *\" or @hourly",
+		Value:  "0 3 * * *",
+		EnvVar: "BACKYARD_SCHEDULE",
+	},
+}
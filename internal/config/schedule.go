@@ -0,0 +1,136 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is when to run, by a cron spec of minute, hour, day of month, month and day of week.
+type Schedule struct {
+	spec                   string
+	minute, hour, dom, mon []bool
+	dow                    []bool
+	domStar, dowStar       bool
+}
+
+// scheduleAliases are specs by name.
+var scheduleAliases = map[string]string{
+	"@hourly":  "0 * * * *",
+	"@daily":   "0 0 * * *",
+	"@weekly":  "0 0 * * 0",
+	"@monthly": "0 0 1 * *",
+}
+
+// ParseSchedule parses a cron spec like "30 3 * * 1-5", with lists, ranges, steps like */15 and aliases like @daily.
+func ParseSchedule(spec string) (*Schedule, error) {
+	s := &Schedule{spec: spec}
+	if alias, ok := scheduleAliases[spec]; ok {
+		spec = alias
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("schedule: %q must have 5 fields: minute hour day-of-month month day-of-week", s.spec)
+	}
+
+	var err error
+	if s.minute, err = scheduleField(fields[0], 0, 59); err != nil {
+		return nil, err
+	}
+	if s.hour, err = scheduleField(fields[1], 0, 23); err != nil {
+		return nil, err
+	}
+	if s.dom, err = scheduleField(fields[2], 1, 31); err != nil {
+		return nil, err
+	}
+	if s.mon, err = scheduleField(fields[3], 1, 12); err != nil {
+		return nil, err
+	}
+	if s.dow, err = scheduleField(fields[4], 0, 7); err != nil {
+		return nil, err
+	}
+	s.dow[0], s.dow = s.dow[0] || s.dow[7], s.dow[:7] // 7 is sunday too
+	s.domStar, s.dowStar = fields[2] == "*", fields[4] == "*"
+
+	return s, nil
+}
+
+// scheduleField parses a field of a cron spec into the values from min to max it matches.
+func scheduleField(field string, min, max int) ([]bool, error) {
+	values := make([]bool, max+1)
+	for _, part := range strings.Split(field, ",") {
+		rng, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("schedule: invalid step in %q", part)
+			}
+			rng, step = part[:i], n
+		}
+
+		lo, hi := min, max
+		if rng != "*" {
+			var err error
+			bounds := strings.SplitN(rng, "-", 2)
+			if lo, err = strconv.Atoi(bounds[0]); err != nil {
+				return nil, fmt.Errorf("schedule: invalid value in %q", part)
+			}
+			hi = lo
+			if len(bounds) == 2 {
+				if hi, err = strconv.Atoi(bounds[1]); err != nil {
+					return nil, fmt.Errorf("schedule: invalid range in %q", part)
+				}
+			} else if step > 1 {
+				hi = max // like 5/15
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return nil, fmt.Errorf("schedule: %q out of %d-%d", part, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			values[v] = true
+		}
+	}
+	return values, nil
+}
+
+// dayMatches returns true if t is a day to run on: by either day of month or day of week if both are given, like cron.
+func (s *Schedule) dayMatches(t time.Time) bool {
+	dom, dow := s.dom[t.Day()], s.dow[t.Weekday()]
+	switch {
+	case s.domStar && s.dowStar:
+		return true
+	case s.domStar:
+		return dow
+	case s.dowStar:
+		return dom
+	}
+	return dom || dow
+}
+
+// Next returns the first time to run after t, or the zero time if none in years.
+func (s *Schedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	until := t.AddDate(5, 0, 0)
+	for t.Before(until) {
+		switch {
+		case !s.mon[t.Month()]:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !s.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		case !s.hour[t.Hour()]:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+		case !s.minute[t.Minute()]:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (s *Schedule) String() string {
+	return s.spec
+}
@@ -0,0 +1,43 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSchedule(t *testing.T) {
+	from := time.Date(2022, 11, 30, 3, 30, 0, 0, time.UTC) // a wednesday
+
+	for spec, next := range map[string]time.Time{
+		"0 3 * * *":      time.Date(2022, 12, 1, 3, 0, 0, 0, time.UTC),
+		"*/15 * * * *":   time.Date(2022, 11, 30, 3, 45, 0, 0, time.UTC),
+		"30 3 * * *":     time.Date(2022, 12, 1, 3, 30, 0, 0, time.UTC),
+		"0 22 * * 1-5":   time.Date(2022, 11, 30, 22, 0, 0, 0, time.UTC),
+		"0 0 * * 7":      time.Date(2022, 12, 4, 0, 0, 0, 0, time.UTC),
+		"0 0 31 * *":     time.Date(2022, 12, 31, 0, 0, 0, 0, time.UTC),
+		"0 0 1 * 6":      time.Date(2022, 12, 1, 0, 0, 0, 0, time.UTC), // the 1st or a saturday
+		"0 12 29 2 *":    time.Date(2024, 2, 29, 12, 0, 0, 0, time.UTC),
+		"@weekly":        time.Date(2022, 12, 4, 0, 0, 0, 0, time.UTC),
+		"5,10 4-6/2 * *": {},
+	} {
+		s, err := ParseSchedule(spec)
+		if next.IsZero() {
+			assert.Error(t, err, spec)
+			continue
+		}
+		if assert.NoError(t, err, spec) {
+			assert.Equal(t, next, s.Next(from), spec)
+			assert.Equal(t, spec, s.String())
+		}
+	}
+
+	for _, spec := range []string{"60 * * * *", "* * * * * *", "5-1 * * * *", "*/0 * * * *", "x * * * *"} {
+		_, err := ParseSchedule(spec)
+		assert.Error(t, err, spec)
+	}
+
+	s, _ := ParseSchedule("0 0 30 2 *")
+	assert.True(t, s.Next(from).IsZero(), "never")
+}
@@ -122,6 +122,12 @@ func (data *Data) Exif(fileName string, fileFormat fs.Type, bruteForce bool) (er
 		}
 	}
 
+	if value, ok := data.exif["OffsetTimeOriginal"]; ok {
+		data.OffsetTimeOriginal = SanitizeString(value)
+	} else if value, ok := data.exif["OffsetTime"]; ok {
+		data.OffsetTimeOriginal = SanitizeString(value)
+	}
+
 	if value, ok := data.exif["Artist"]; ok {
 		data.Artist = SanitizeString(value)
 	}
@@ -0,0 +1,364 @@
+package meta
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/photoprism/go-tz.v2/tz"
+
+	"github.com/photoprism/photoprism/pkg/clean"
+)
+
+// mp4Epoch is when mvhd times count from.
+var mp4Epoch = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// mp4MaxMoov limits the moov box read into memory, it has the sample tables of the whole video.
+const mp4MaxMoov = 64 << 20
+
+// mp4Box is an ISO base media box, like moov.
+type mp4Box struct {
+	Type string
+	Data []byte // payload after the header
+}
+
+// MP4 parses an MP4 or QuickTime MOV file for metadata and returns as Data struct.
+func MP4(fileName string) (data Data, err error) {
+	err = data.MP4(fileName)
+
+	return data, err
+}
+
+// MP4 parses an MP4 or QuickTime MOV file for creation dates in moov/mvhd, moov/udta and moov/meta,
+// as well as camera and location, without exiftool.
+func (data *Data) MP4(fileName string) (err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("metadata: %s in %s (mp4 panic)\nstack: %s", e, clean.Log(filepath.Base(fileName)), debug.Stack())
+		}
+	}()
+
+	logName := clean.Log(filepath.Base(fileName))
+
+	file, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var moov []byte
+	brand := ""
+	for {
+		boxType, size, err := mp4ReadHeader(file)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("metadata: %s in %s (mp4)", err, logName)
+		}
+
+		switch {
+		case boxType == "ftyp" && size >= 4:
+			buf := make([]byte, 4)
+			if _, err := io.ReadFull(file, buf); err != nil {
+				return fmt.Errorf("metadata: %s in %s (mp4)", err, logName)
+			}
+			brand = string(buf)
+			size = size - 4
+		case boxType == "moov":
+			if size < 0 || size > mp4MaxMoov {
+				return fmt.Errorf("metadata: moov of %d bytes too large in %s (mp4)", size, logName)
+			}
+			moov = make([]byte, size)
+			if _, err := io.ReadFull(file, moov); err != nil {
+				return fmt.Errorf("metadata: %s in %s (mp4)", err, logName)
+			}
+			size = 0
+		}
+		if moov != nil {
+			break
+		}
+		if size < 0 { // up to end of file
+			break
+		}
+		if _, err := file.Seek(size, io.SeekCurrent); err != nil {
+			return fmt.Errorf("metadata: %s in %s (mp4)", err, logName)
+		}
+	}
+
+	if moov == nil {
+		return fmt.Errorf("metadata: no moov box in %s", logName)
+	}
+
+	if brand == "qt  " {
+		data.MIMEType = MimeQuicktime
+	} else {
+		data.MIMEType = MimeVideoMP4
+	}
+
+	var created time.Time // utc
+	var dateTime string   // with offset, from udta or meta
+	var location string   // iso 6709
+	for _, box := range mp4Boxes(moov) {
+		switch box.Type {
+		case "mvhd":
+			created = data.mp4Mvhd(box.Data)
+		case "udta":
+			for _, u := range mp4Boxes(box.Data) {
+				switch u.Type {
+				case "\xa9day":
+					dateTime = mp4Text(u.Data)
+				case "\xa9xyz":
+					location = mp4Text(u.Data)
+				case "meta":
+					data.mp4Meta(u.Data, &dateTime, &location)
+				}
+			}
+		case "meta":
+			data.mp4Meta(box.Data, &dateTime, &location)
+		}
+	}
+
+	if !created.IsZero() {
+		data.CreatedAt = created
+	}
+	if lat, lng, ok := mp4Location(location); ok {
+		data.Lat, data.Lng = lat, lng
+		if zones, err := tz.GetZone(tz.Point{Lat: float64(lat), Lon: float64(lng)}); err == nil && len(zones) > 0 {
+			data.TimeZone = zones[0]
+		}
+	}
+
+	taken, offset := mp4DateTime(dateTime)
+	if taken.IsZero() {
+		taken = created
+	}
+	if taken.IsZero() {
+		return fmt.Errorf("metadata: no creation date in %s (mp4)", logName)
+	}
+
+	// Same as exiftool data: local wall clock in utc, and TimeZone or OffsetTimeOriginal telling its zone.
+	if loc, err := time.LoadLocation(data.TimeZone); data.TimeZone != "" && err == nil {
+		data.TakenAt = taken.UTC()
+		data.TakenAtLocal = mp4WallClock(taken.In(loc))
+	} else if offset != "" {
+		data.TimeZone = ""
+		data.OffsetTimeOriginal = offset
+		data.TakenAtLocal = mp4WallClock(taken)
+		data.TakenAt = data.TakenAtLocal
+	} else {
+		// Assume default time zone for MP4 & Quicktime videos is UTC.
+		// see https://exiftool.org/TagNames/QuickTime.html
+		data.TimeZone = time.UTC.String()
+		data.TakenAt = taken.UTC()
+		data.TakenAtLocal = data.TakenAt
+	}
+
+	return nil
+}
+
+// mp4ReadHeader reads a box header, and returns its type and payload size, -1 if up to the end of file.
+func mp4ReadHeader(r io.Reader) (boxType string, size int64, err error) {
+	var header [8]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+		return "", 0, err
+	}
+
+	size = int64(binary.BigEndian.Uint32(header[0:4]))
+	boxType = string(header[4:8])
+	switch size {
+	case 0:
+		return boxType, -1, nil
+	case 1:
+		var large [8]byte
+		if _, err := io.ReadFull(r, large[:]); err != nil {
+			return "", 0, err
+		}
+		size = int64(binary.BigEndian.Uint64(large[:])) - 16
+	default:
+		size = size - 8
+	}
+	if size < -1 {
+		return "", 0, fmt.Errorf("invalid size of box %q", boxType)
+	}
+
+	return boxType, size, nil
+}
+
+// mp4Boxes splits buf into the boxes it contains, skipping what can not be parsed.
+func mp4Boxes(buf []byte) (boxes []mp4Box) {
+	r := bytes.NewReader(buf)
+	for {
+		boxType, size, err := mp4ReadHeader(r)
+		if err != nil {
+			return boxes
+		}
+		if size < 0 || size > int64(r.Len()) {
+			size = int64(r.Len())
+		}
+		payload := make([]byte, size)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			return boxes
+		}
+		boxes = append(boxes, mp4Box{Type: boxType, Data: payload})
+	}
+}
+
+// mp4Mvhd reads the duration and the creation time of the movie header, zero if unknown.
+func (data *Data) mp4Mvhd(buf []byte) (created time.Time) {
+	if len(buf) < 20 {
+		return created
+	}
+
+	var seconds uint64
+	var timescale uint32
+	var duration uint64
+	if buf[0] == 1 && len(buf) >= 32 {
+		seconds = binary.BigEndian.Uint64(buf[4:12])
+		timescale = binary.BigEndian.Uint32(buf[20:24])
+		duration = binary.BigEndian.Uint64(buf[24:32])
+	} else {
+		seconds = uint64(binary.BigEndian.Uint32(buf[4:8]))
+		timescale = binary.BigEndian.Uint32(buf[12:16])
+		duration = uint64(binary.BigEndian.Uint32(buf[16:20]))
+	}
+
+	if timescale > 0 && duration > 0 && data.Duration == 0 {
+		data.Duration = time.Duration(float64(duration) / float64(timescale) * float64(time.Second))
+	}
+	if seconds == 0 {
+		return created
+	}
+
+	return mp4Epoch.Add(time.Duration(seconds) * time.Second)
+}
+
+// mp4Meta reads quicktime keys and items of a meta box, and iTunes style items as in udta.
+func (data *Data) mp4Meta(buf []byte, dateTime, location *string) {
+	if len(buf) >= 8 && string(buf[4:8]) != "hdlr" { // full box in udta, with version and flags
+		buf = buf[4:]
+	}
+
+	var keys []string
+	for _, box := range mp4Boxes(buf) {
+		switch box.Type {
+		case "keys":
+			if len(box.Data) < 8 {
+				continue
+			}
+			for _, key := range mp4Boxes(box.Data[8:]) {
+				keys = append(keys, string(key.Data))
+			}
+		case "ilst":
+			for _, item := range mp4Boxes(box.Data) {
+				name := item.Type
+				if index := int(binary.BigEndian.Uint32([]byte(item.Type))); index > 0 && index <= len(keys) {
+					name = keys[index-1]
+				}
+				value := mp4ItemValue(item.Data)
+				if value == "" {
+					continue
+				}
+
+				switch name {
+				case "com.apple.quicktime.creationdate":
+					*dateTime = value
+				case "\xa9day":
+					if *dateTime == "" {
+						*dateTime = value
+					}
+				case "com.apple.quicktime.location.ISO6709", "\xa9xyz":
+					*location = value
+				case "com.apple.quicktime.make":
+					data.CameraMake = SanitizeString(value)
+				case "com.apple.quicktime.model":
+					data.CameraModel = SanitizeString(value)
+				case "com.apple.quicktime.software":
+					data.Software = SanitizeString(value)
+				}
+			}
+		}
+	}
+}
+
+// mp4ItemValue returns the text in the data box of a metadata item.
+func mp4ItemValue(buf []byte) string {
+	for _, box := range mp4Boxes(buf) {
+		if box.Type == "data" && len(box.Data) >= 8 {
+			return strings.TrimSpace(string(box.Data[8:]))
+		}
+	}
+	return ""
+}
+
+// mp4Text returns the text of a quicktime user data item, like ©day, after its size and language.
+func mp4Text(buf []byte) string {
+	if len(buf) >= 16 && string(buf[4:8]) == "data" { // iTunes style data box instead
+		return mp4ItemValue(buf)
+	}
+	if len(buf) < 4 {
+		return ""
+	}
+
+	size := int(binary.BigEndian.Uint16(buf[0:2]))
+	text := buf[4:]
+	if size < len(text) {
+		text = text[:size]
+	}
+
+	return strings.TrimSpace(string(text))
+}
+
+var mp4DateLayouts = []string{
+	"2006-01-02T15:04:05-0700",
+	"2006-01-02T15:04:05Z07:00",
+	"2006-01-02T15:04:05.000-0700",
+	"2006-01-02T15:04:05.000Z07:00",
+}
+
+// mp4DateTime parses a date time with offset, like 2019-05-12T10:00:00+0200, and returns the offset like +02:00.
+func mp4DateTime(s string) (t time.Time, offset string) {
+	s = strings.TrimSpace(s)
+	for _, layout := range mp4DateLayouts {
+		if parsed, err := time.Parse(layout, s); err == nil {
+			if strings.HasSuffix(s, "Z") {
+				return parsed, ""
+			}
+			return parsed, parsed.Format("-07:00")
+		}
+	}
+	return t, ""
+}
+
+// mp4WallClock returns the wall clock of t in utc.
+func mp4WallClock(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.UTC)
+}
+
+var mp4LocationRegexp = regexp.MustCompile(`^([+-]\d+(?:\.\d+)?)([+-]\d+(?:\.\d+)?)`)
+
+// mp4Location parses an ISO 6709 location, like +52.5200+013.4050+034.000/
+func mp4Location(s string) (lat, lng float32, ok bool) {
+	m := mp4LocationRegexp.FindStringSubmatch(s)
+	if m == nil {
+		return 0, 0, false
+	}
+
+	la, errLat := strconv.ParseFloat(m[1], 32)
+	lo, errLng := strconv.ParseFloat(m[2], 32)
+	if errLat != nil || errLng != nil || (la == 0 && lo == 0) {
+		return 0, 0, false
+	}
+
+	return float32(la), float32(lo), true
+}
@@ -0,0 +1,119 @@
+package meta
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func mp4TestBox(boxType string, payload ...[]byte) []byte {
+	size := 8
+	for _, p := range payload {
+		size += len(p)
+	}
+	buf := make([]byte, 8, size)
+	binary.BigEndian.PutUint32(buf[0:4], uint32(size))
+	copy(buf[4:8], boxType)
+	for _, p := range payload {
+		buf = append(buf, p...)
+	}
+	return buf
+}
+
+func mp4TestMvhd(created time.Time, timescale, duration uint32) []byte {
+	buf := make([]byte, 100)
+	binary.BigEndian.PutUint32(buf[4:8], uint32(created.Sub(mp4Epoch)/time.Second))
+	binary.BigEndian.PutUint32(buf[12:16], timescale)
+	binary.BigEndian.PutUint32(buf[16:20], duration)
+	return mp4TestBox("mvhd", buf)
+}
+
+func mp4TestKeys(keys ...string) []byte {
+	head := make([]byte, 8)
+	binary.BigEndian.PutUint32(head[4:8], uint32(len(keys)))
+	payload := [][]byte{head}
+	for _, key := range keys {
+		payload = append(payload, mp4TestBox("mdta", []byte(key)))
+	}
+	return mp4TestBox("keys", payload...)
+}
+
+func mp4TestItem(index uint32, value string) []byte {
+	var name [4]byte
+	binary.BigEndian.PutUint32(name[:], index)
+	return mp4TestBox(string(name[:]), mp4TestBox("data", make([]byte, 8), []byte(value)))
+}
+
+func mp4TestFile(t *testing.T, boxes ...[]byte) string {
+	fileName := filepath.Join(t.TempDir(), "test.mp4")
+	var buf []byte
+	for _, box := range boxes {
+		buf = append(buf, box...)
+	}
+	if err := os.WriteFile(fileName, buf, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return fileName
+}
+
+func TestMP4(t *testing.T) {
+	created := time.Date(2019, 5, 12, 8, 0, 0, 0, time.UTC)
+
+	t.Run("mvhd", func(t *testing.T) {
+		fileName := mp4TestFile(t,
+			mp4TestBox("ftyp", []byte("isom"), make([]byte, 4)),
+			mp4TestBox("mdat", make([]byte, 32)),
+			mp4TestBox("moov", mp4TestMvhd(created, 1000, 2500)))
+
+		data, err := MP4(fileName)
+		assert.NoError(t, err)
+		assert.Equal(t, MimeVideoMP4, data.MIMEType)
+		assert.Equal(t, created, data.TakenAt)
+		assert.Equal(t, created, data.TakenAtLocal)
+		assert.Equal(t, "UTC", data.TimeZone)
+		assert.Equal(t, 2500*time.Millisecond, data.Duration)
+	})
+
+	t.Run("udta day with offset", func(t *testing.T) {
+		day := make([]byte, 4)
+		binary.BigEndian.PutUint16(day[0:2], 24)
+		fileName := mp4TestFile(t,
+			mp4TestBox("ftyp", []byte("qt  "), make([]byte, 4)),
+			mp4TestBox("moov", mp4TestMvhd(created, 600, 600),
+				mp4TestBox("udta", mp4TestBox("\xa9day", day, []byte("2019-05-12T10:00:00+0200")))))
+
+		data, err := MP4(fileName)
+		assert.NoError(t, err)
+		assert.Equal(t, MimeQuicktime, data.MIMEType)
+		assert.Equal(t, "+02:00", data.OffsetTimeOriginal)
+		assert.Equal(t, "", data.TimeZone)
+		assert.Equal(t, "2019-05-12T10:00:00Z", data.TakenAtLocal.Format(time.RFC3339))
+	})
+
+	t.Run("quicktime keys", func(t *testing.T) {
+		fileName := mp4TestFile(t,
+			mp4TestBox("ftyp", []byte("qt  "), make([]byte, 4)),
+			mp4TestBox("moov", mp4TestMvhd(created, 600, 600),
+				mp4TestBox("meta",
+					mp4TestBox("hdlr", make([]byte, 24)),
+					mp4TestKeys("com.apple.quicktime.creationdate", "com.apple.quicktime.model"),
+					mp4TestBox("ilst", mp4TestItem(1, "2019-05-12T10:00:00+0200"), mp4TestItem(2, "iPhone XS")))))
+
+		data, err := MP4(fileName)
+		assert.NoError(t, err)
+		assert.Equal(t, "iPhone XS", data.CameraModel)
+		assert.Equal(t, "+02:00", data.OffsetTimeOriginal)
+		assert.Equal(t, "2019-05-12T10:00:00Z", data.TakenAt.Format(time.RFC3339))
+	})
+
+	t.Run("no moov", func(t *testing.T) {
+		fileName := mp4TestFile(t, mp4TestBox("ftyp", []byte("isom"), make([]byte, 4)))
+
+		_, err := MP4(fileName)
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,146 @@
+package mutex
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// LockHolder tells who holds a lock.
+type LockHolder struct {
+	Hostname string    `json:"hostname"`
+	Pid      int       `json:"pid"`
+	Command  string    `json:"command"`
+	Started  time.Time `json:"started"`
+}
+
+func (h LockHolder) String() string {
+	return fmt.Sprintf("%q (pid %v on %v) since %v", h.Command, h.Pid, h.Hostname, h.Started.Format(time.RFC3339))
+}
+
+// LockedError is returned when a lock is held by another process.
+type LockedError struct {
+	Name   string
+	Holder LockHolder
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("lock: %v is held by %v", e.Name, e.Holder)
+}
+
+// FileLock is an advisory lock across processes sharing a filesystem, by flock on a lock file,
+// which tells who holds it. across hosts on NFS, it holds only if the mount passes flock to the server,
+// as linux does since 2.6.12 unless mounted with local_lock, otherwise each host locks on its own.
+type FileLock struct {
+	Name     string
+	TookOver *LockHolder // of a lock file left by a holder gone, if taken over
+	file     *os.File
+}
+
+// TryLock takes the lock of file name, or returns a *LockedError if another process holds it.
+// the flock decides alone: a lock file left by a holder gone, its flock released with it, is taken over,
+// but a lock file flocked is never, however old it looks.
+func TryLock(name string) (*FileLock, error) {
+	for attempt := 0; attempt < 3; attempt++ {
+		f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("lock: %v", err)
+		}
+
+		if err := flock(f); err != nil {
+			f.Close()
+			if !errors.Is(err, errLocked) {
+				return nil, fmt.Errorf("lock: %v - %v", name, err)
+			}
+			return nil, &LockedError{Name: name, Holder: readLockHolder(name)}
+		}
+
+		if !sameFile(f, name) { // removed by an unlock meanwhile
+			f.Close()
+			continue
+		}
+		var took *LockHolder
+		if holder := readLockHolder(name); holder.Pid != 0 {
+			took = &holder // left by a holder gone without unlocking
+		}
+
+		l := &FileLock{Name: name, TookOver: took, file: f}
+		if err := l.writeHolder(); err != nil {
+			l.Unlock()
+			return nil, err
+		}
+		return l, nil
+	}
+	return nil, fmt.Errorf("lock: %v keeps changing", name)
+}
+
+// Lock takes the lock of file name, waiting up to wait for another process to release it.
+func Lock(name string, wait time.Duration) (*FileLock, error) {
+	deadline := time.Now().Add(wait)
+	for {
+		l, err := TryLock(name)
+		var locked *LockedError
+		if err == nil || !errors.As(err, &locked) || !time.Now().Before(deadline) {
+			return l, err
+		}
+		pause := time.Until(deadline)
+		if pause > time.Second {
+			pause = time.Second
+		}
+		time.Sleep(pause)
+	}
+}
+
+// Unlock releases the lock, removing its file if still the one locked, before the flock is released.
+// where a file open can not be removed, as on windows, its holder info is cleared instead.
+func (l *FileLock) Unlock() error {
+	if sameFile(l.file, l.Name) {
+		if err := os.Remove(l.Name); err != nil {
+			l.file.Truncate(0)
+		}
+	}
+	return l.file.Close()
+}
+
+// writeHolder writes who holds the lock into its file.
+func (l *FileLock) writeHolder() error {
+	hostname, _ := os.Hostname()
+	data, err := json.Marshal(LockHolder{
+		Hostname: hostname,
+		Pid:      os.Getpid(),
+		Command:  filepath.Base(os.Args[0]) + " " + strings.Join(os.Args[1:], " "),
+		Started:  time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	if err := l.file.Truncate(0); err != nil {
+		return fmt.Errorf("lock: %v", err)
+	}
+	if _, err := l.file.WriteAt(data, 0); err != nil {
+		return fmt.Errorf("lock: %v", err)
+	}
+	return l.file.Sync()
+}
+
+// readLockHolder returns who holds, or held, the lock of file name.
+func readLockHolder(name string) (holder LockHolder) {
+	if data, err := os.ReadFile(name); err == nil {
+		json.Unmarshal(data, &holder)
+	}
+	return holder
+}
+
+// sameFile returns true if f is still the file of name.
+func sameFile(f *os.File, name string) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	ni, err := os.Stat(name)
+	return err == nil && os.SameFile(fi, ni)
+}
@@ -0,0 +1,92 @@
+package mutex
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileLock(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "8ackyard.lock")
+
+	t.Run("held", func(t *testing.T) {
+		l, err := TryLock(name)
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Nil(t, l.TookOver)
+
+		_, err = TryLock(name)
+		var locked *LockedError
+		if assert.True(t, errors.As(err, &locked)) {
+			assert.Equal(t, os.Getpid(), locked.Holder.Pid)
+			assert.Contains(t, err.Error(), "is held by")
+		}
+
+		assert.NoError(t, l.Unlock())
+		_, err = os.Stat(name)
+		assert.True(t, os.IsNotExist(err))
+	})
+
+	t.Run("wait", func(t *testing.T) {
+		l, err := TryLock(name)
+		if !assert.NoError(t, err) {
+			return
+		}
+		_, err = Lock(name, 100*time.Millisecond)
+		assert.Error(t, err)
+
+		time.AfterFunc(300*time.Millisecond, func() { l.Unlock() })
+		l, err = Lock(name, 5*time.Second)
+		if assert.NoError(t, err) {
+			l.Unlock()
+		}
+	})
+
+	t.Run("old", func(t *testing.T) {
+		l, err := TryLock(name)
+		if !assert.NoError(t, err) {
+			return
+		}
+		old := time.Now().Add(-24 * time.Hour)
+		os.Chtimes(name, old, old)
+
+		_, err = TryLock(name)
+		var locked *LockedError
+		assert.True(t, errors.As(err, &locked), "flocked, never taken over however old")
+		assert.NoError(t, l.Unlock())
+	})
+
+	t.Run("unlock", func(t *testing.T) {
+		l, err := TryLock(name)
+		if !assert.NoError(t, err) {
+			return
+		}
+		os.Remove(name) // by hand, another takes a new lock file
+		l2, err := TryLock(name)
+		if !assert.NoError(t, err) {
+			return
+		}
+		l.Unlock()
+		_, err = os.Stat(name)
+		assert.NoError(t, err, "not removed, of another")
+		_, err = TryLock(name)
+		assert.Error(t, err)
+		l2.Unlock()
+	})
+
+	t.Run("left", func(t *testing.T) {
+		os.WriteFile(name, []byte(`{"hostname":"nas","pid":42}`), 0644)
+		l, err := TryLock(name)
+		if assert.NoError(t, err) {
+			if assert.NotNil(t, l.TookOver) {
+				assert.Equal(t, "nas", l.TookOver.Hostname)
+			}
+			l.Unlock()
+		}
+	})
+}
@@ -0,0 +1,21 @@
+//go:build !windows
+
+package mutex
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+var errLocked = unix.EWOULDBLOCK
+
+// flock locks f exclusively, or fails with errLocked if locked already.
+func flock(f *os.File) error {
+	for {
+		err := unix.Flock(int(f.Fd()), unix.LOCK_EX|unix.LOCK_NB)
+		if err != unix.EINTR {
+			return err
+		}
+	}
+}
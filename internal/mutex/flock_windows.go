@@ -0,0 +1,16 @@
+package mutex
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+var errLocked = windows.ERROR_LOCK_VIOLATION
+
+// flock locks f exclusively, or fails with errLocked if locked already.
+// the range locked is a byte far beyond the holder info, which windows would not let others read if locked.
+func flock(f *os.File) error {
+	ol := &windows.Overlapped{OffsetHigh: 1 << 30}
+	return windows.LockFileEx(windows.Handle(f.Fd()), windows.LOCKFILE_EXCLUSIVE_LOCK|windows.LOCKFILE_FAIL_IMMEDIATELY, 0, 1, 0, ol)
+}